@@ -0,0 +1,87 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/shilangyu/driveignore/utils"
+)
+
+// operationMessages are the prints of performed operations and the ones in dry run mode
+var operationMessages = map[utils.OpKind][2]string{
+	utils.OpMkdir:   {"created directory:", "would create directory:"},
+	utils.OpLink:    {"created hard link:", "would create hard link:"},
+	utils.OpReplace: {"overwritting a file with same name:", "would overwrite a file with same name:"},
+	utils.OpRemove:  {"moved to trash:", "would move to trash:"},
+	utils.OpRecord:  {"recorded in manifest:", "would record in manifest:"},
+	utils.OpRestore: {"restored from drive folder:", "would restore from drive folder:"},
+}
+
+// applyPlan performs the plan printing every operation in verbose mode, removed entries go to the trash.
+// In dry run mode the operations are only printed out
+func applyPlan(plan *utils.Plan, dryRun bool, out *reporter, vPrint func(...interface{})) error {
+	if dryRun {
+		for _, op := range plan.Operations {
+			if out.machine() {
+				rec := operationRecord(plan, op)
+				rec.DryRun = true
+				out.report(rec)
+			} else {
+				fmt.Println(operationMessages[op.Kind][1], op.Path)
+			}
+		}
+		return nil
+	}
+
+	trash, err := openTrash()
+	if err != nil {
+		return err
+	}
+	plan.Trash = trash.Path
+	err = plan.Apply(func(op utils.Operation) {
+		if out.machine() {
+			out.report(operationRecord(plan, op))
+			return
+		}
+		message := operationMessages[op.Kind][0]
+		// hard links might have fallen back to a copy
+		if op.Kind == utils.OpLink && op.Method != utils.LinkHard {
+			message = "created " + string(op.Method) + ":"
+		}
+		vPrint(message, op.Path)
+	})
+	entry := plan.Trashed()
+	if entry == nil {
+		return err
+	}
+	vPrint("removed and replaced entries can be brought back with: driveignore trash restore", entry.ID)
+	if err != nil {
+		return err
+	}
+	return expireTrash(vPrint)
+}
+
+// skippedPrinter creates a function printing the entries skipped because of a .driveignore
+func skippedPrinter(vPrint func(...interface{})) func(string, os.FileInfo, string) {
+	return func(currPath string, info os.FileInfo, relativePath string) {
+		if info.IsDir() {
+			vPrint("skipped directory:", relativePath)
+		} else {
+			vPrint("skipped file:", relativePath)
+		}
+	}
+}
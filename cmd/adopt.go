@@ -0,0 +1,83 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+// adoptCmd represents the adopt command
+var adoptCmd = &cobra.Command{
+	Use:   "adopt [drive sync folder path]",
+	Short: "Turns identical copies in the drive folder into hard links",
+	Long: `Drive sync folders filled by copying or restored from a backup hold copies
+of the input files instead of hard links, so upload refuses to touch them.
+
+Adopt compares every file of the drive sync folder with the input file at the same
+path and replaces the ones with byte for byte the same content with a hard link.
+Files whose content differs are only reported.
+`,
+	Example: "driveignore adopt ~/Drive/project --dry-run",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose)
+
+		if err := applySettings(cmd, adoptInput); err != nil {
+			return err
+		}
+		destination, err := destinationPath(adoptInput, args)
+		if err != nil {
+			return err
+		}
+
+		driveignore, err := loadDriveIgnore(adoptInput, utils.IgnoreOptions{MergeIgnores: adoptMergeIgnores, UseGitignore: adoptUseGitignore, Git: utils.GitMode(adoptGit)}, vPrint)
+		if err != nil {
+			return err
+		}
+
+		plan, err := utils.PlanAdopt(adoptInput, destination, driveignore, utils.PlanOptions{
+			WalkOptions: utils.WalkOptions{Jobs: jobs},
+			Skipped:     skippedPrinter(vPrint),
+		})
+		if err != nil {
+			return err
+		}
+		for _, conflict := range plan.Conflicts {
+			fmt.Printf("cannot adopt '%s'. The content differs from the input file.\n", conflict)
+		}
+
+		return applyPlan(plan, adoptDryRun, textOutput, vPrint)
+	},
+	Args: destinationArgs(&adoptInput),
+}
+
+var adoptInput string
+var adoptMergeIgnores bool
+var adoptUseGitignore bool
+var adoptGit string
+var adoptDryRun bool
+
+func init() {
+	rootCmd.AddCommand(adoptCmd)
+
+	// Local flags
+	adoptCmd.Flags().StringVarP(&adoptInput, "input", "i", ".", "Input directory of the files to be adopted")
+	adoptCmd.Flags().BoolVarP(&adoptMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	adoptCmd.Flags().BoolVar(&adoptUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	adoptCmd.Flags().StringVar(&adoptGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	adoptCmd.Flags().BoolVar(&adoptDryRun, "dry-run", false, "Prints what would be done without touching the filesystem")
+}
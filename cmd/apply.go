@@ -0,0 +1,85 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	errPlanOutdated = errors.New("The trees changed since the plan was made, create a new one")
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply [plan file]",
+	Short: "Performs the operations of a saved plan",
+	Long: `Performs the operations saved by 'driveignore plan'.
+Before anything is touched the plan is computed again and if the input
+or the drive sync folder changed since the plan was made nothing is applied.
+`,
+	Example: "driveignore apply plan.json",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose)
+
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		var plan utils.Plan
+		if err := json.Unmarshal(data, &plan); err != nil {
+			return err
+		}
+		plan.Jobs = jobs
+
+		driveignore, err := loadDriveIgnore(plan.Input, utils.IgnoreOptions{MergeIgnores: plan.MergeIgnores, UseGitignore: plan.UseGitignore, Git: plan.Git}, vPrint)
+		if err != nil {
+			return err
+		}
+		opts := utils.PlanOptions{WalkOptions: plan.WalkOptions, LinkMode: plan.LinkMode}
+		if plan.CleanIgnored {
+			opts.Ignored = driveignore
+		}
+		current, err := utils.PlanUnify(plan.Input, plan.Destination, driveignore, opts)
+		if err != nil {
+			return err
+		}
+		if plan.Changed(current) {
+			return errPlanOutdated
+		}
+
+		return applyPlan(&plan, applyDryRun, textOutput, vPrint)
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("There should only be one argument")
+		}
+		return nil
+	},
+}
+
+var applyDryRun bool
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	// Local flags
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "Prints what would be done without touching the filesystem")
+}
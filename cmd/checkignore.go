@@ -0,0 +1,152 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+// checkIgnoreCmd represents the check-ignore command
+var checkIgnoreCmd = &cobra.Command{
+	Use:   "check-ignore [paths to check]",
+	Short: "Explains why paths are ignored",
+	Long: `For every passed path prints whether it is ignored and which rule decided it:
+the .driveignore file, line number and pattern.
+
+Output format (same as 'git check-ignore -v'):
+<source>:<line>:<pattern>	<path>
+
+With --verbose the kind of the .driveignore (local, global, merged or nested)
+is put in front: <kind>:<source>:<line>:<pattern>	<path>
+
+Paths matched by a negated pattern (!pattern) are not ignored but are still printed.
+Like git, it exits with 1 when no rule matched any of the paths.
+`,
+	Example: "driveignore check-ignore build/main.o\nfind . | driveignore check-ignore --stdin",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose)
+
+		driveignore, err := loadDriveIgnore(checkIgnoreInput, utils.IgnoreOptions{MergeIgnores: checkIgnoreMergeIgnores, UseGitignore: checkIgnoreUseGitignore, Git: utils.GitMode(checkIgnoreGit)}, vPrint)
+		if err != nil {
+			return err
+		}
+
+		inputAbs, err := filepath.Abs(checkIgnoreInput)
+		if err != nil {
+			return err
+		}
+
+		matched := false
+		check := func(path string) error {
+			pathAbs, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			relativePath, err := filepath.Rel(inputAbs, pathAbs)
+			if err != nil || strings.HasPrefix(relativePath, "..") {
+				return &utils.ConfigError{Err: fmt.Errorf("'%s' is outside of the input directory", path)}
+			}
+
+			// nonexistent paths are treated as files unless they end with a slash
+			isDir := strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(filepath.Separator))
+			if fstat, err := os.Stat(path); err == nil {
+				isDir = fstat.IsDir()
+			}
+
+			d := driveignore.Explain(filepath.Join(checkIgnoreInput, relativePath), isDir)
+			kind := ""
+			switch {
+			case d == nil && !checkIgnoreNonMatching:
+				return nil
+			case d == nil:
+				if verbose {
+					kind = ":"
+				}
+				fmt.Printf("%s::\t%s\n", kind, path)
+				return nil
+			case verbose:
+				kind = d.Type.String() + ":"
+			}
+			matched = true
+			fmt.Printf("%s%s:%d:%s\t%s\n", kind, d.Source, d.Line, d.Pattern, path)
+			return nil
+		}
+
+		if checkIgnoreStdin {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				if scanner.Text() == "" {
+					continue
+				}
+				if err := check(scanner.Text()); err != nil {
+					return err
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+		}
+
+		for _, path := range args {
+			if err := check(path); err != nil {
+				return err
+			}
+		}
+		// nested .driveignores are read while explaining, an invalid one is a configuration error as well
+		if err := driveignore.Err(); err != nil {
+			return err
+		}
+		if !matched {
+			exitCode = exitDifferences
+		}
+		return nil
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if checkIgnoreStdin && len(args) != 0 {
+			return errors.New("Cannot pass paths together with --stdin")
+		}
+		if !checkIgnoreStdin && len(args) == 0 {
+			return errors.New("There should be at least one argument")
+		}
+		return nil
+	},
+}
+
+var checkIgnoreInput string
+var checkIgnoreMergeIgnores bool
+var checkIgnoreUseGitignore bool
+var checkIgnoreGit string
+var checkIgnoreStdin bool
+var checkIgnoreNonMatching bool
+
+func init() {
+	rootCmd.AddCommand(checkIgnoreCmd)
+
+	// Local flags
+	checkIgnoreCmd.Flags().StringVarP(&checkIgnoreInput, "input", "i", ".", "Input directory the .driveignores are loaded from")
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	checkIgnoreCmd.Flags().BoolVar(&checkIgnoreUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	checkIgnoreCmd.Flags().StringVar(&checkIgnoreGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	checkIgnoreCmd.Flags().BoolVar(&checkIgnoreStdin, "stdin", false, "Reads the paths from stdin, one per line")
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreNonMatching, "non-matching", "n", false, "Also prints paths that no pattern matched")
+}
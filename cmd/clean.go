@@ -15,10 +15,6 @@
 package cmd
 
 import (
-	"errors"
-	"os"
-	"path/filepath"
-
 	"github.com/shilangyu/driveignore/utils"
 	"github.com/spf13/cobra"
 )
@@ -29,44 +25,54 @@ var cleanCmd = &cobra.Command{
 	Short: "Cleans your drive sync folder from old files",
 	Long: `Will look through the drive sync folder and 
 remove files that do not exist in your source files.
+With --ignored also the files that the .driveignores ignore by now are removed.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		vPrint := utils.VPrintWrapper(verbose)
-
-		// remove legacy files
-		err := utils.Walker(args[0], func(currPath string, info os.FileInfo, relativePath string) error {
-			// check if file/directory exists in source folder
-			sourcePath := filepath.Join(cleanInput, relativePath)
-			sourceStat, err := os.Stat(sourcePath)
-			if os.IsNotExist(err) || (!os.SameFile(info, sourceStat) && !info.IsDir()) {
-				os.Remove(currPath)
-				vPrint("Removed:", relativePath)
-			}
-			return nil
-		})
-
-		return err
-	},
-	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 1 {
-			return errors.New("There should only be one argument")
-		}
-		fstat, err := os.Stat(args[0])
-		if os.IsNotExist(err) {
-			return errors.New("Passed path doesnt exist")
+		out, err := newReporter(cleanOutput)
+		if err != nil {
+			return err
 		}
-		if !fstat.IsDir() {
-			return errors.New("Passed path isnt a directory")
+		defer out.flush()
+
+		if err := applySettings(cmd, cleanInput); err != nil {
+			return out.reportError(err)
 		}
-		return nil
+		return out.reportError(reconciliation{
+			input:           cleanInput,
+			mergeIgnores:    cleanMergeIgnores,
+			useGitignore:    cleanUseGitignore,
+			git:             cleanGit,
+			symlinks:        cleanSymlinks,
+			symlinksOutside: cleanSymlinksOutside,
+			dryRun:          cleanDryRun,
+			clean:           true,
+			cleanIgnored:    cleanIgnored,
+		}.run(args, out))
 	},
+	Args: destinationArgs(&cleanInput),
 }
 
 var cleanInput string
+var cleanDryRun bool
+var cleanIgnored bool
+var cleanMergeIgnores bool
+var cleanUseGitignore bool
+var cleanGit string
+var cleanOutput string
+var cleanSymlinks string
+var cleanSymlinksOutside bool
 
 func init() {
 	rootCmd.AddCommand(cleanCmd)
 
 	// Local flags
 	cleanCmd.Flags().StringVarP(&cleanInput, "input", "i", ".", "Input directory of source files")
+	cleanCmd.Flags().BoolVarP(&cleanMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	cleanCmd.Flags().BoolVar(&cleanUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	cleanCmd.Flags().StringVar(&cleanGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	cleanCmd.Flags().BoolVar(&cleanIgnored, "ignored", false, "Also removes uploaded files that the .driveignores ignore by now")
+	cleanCmd.Flags().StringVar(&cleanSymlinks, "symlinks", string(utils.SymlinksPreserve), "What is done with symlinks: preserve, follow, skip or copy-target")
+	cleanCmd.Flags().BoolVar(&cleanSymlinksOutside, "symlinks-outside", false, "Allows following symlinks that point outside of the input directory")
+	cleanCmd.Flags().StringVar(&cleanOutput, "output", outputText, "Output format: text, json or ndjson")
+	cleanCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false, "Prints what would be removed without touching the filesystem")
 }
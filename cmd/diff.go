@@ -15,8 +15,7 @@
 package cmd
 
 import (
-	"errors"
-	"os"
+	"fmt"
 	"path/filepath"
 
 	"github.com/fatih/color"
@@ -26,102 +25,138 @@ import (
 
 // diffCmd represents the upload command
 var diffCmd = &cobra.Command{
-	Use:   "diff [drive sync folder path]",
+	Use:   "diff [drive sync folder path] [-- paths...]",
 	Short: "Compares your directory with the drive one",
 	Long: `Prints out the difference in files between your source (input) and
 drive sync folder ([drive sync folder path])
 
 Red    - your drive sync folder is missing a file
 Yellow - your drive sync folder has a file that doesnt exist in input
+
+With --content files that are no longer linked are compared by size and then
+by a hash of their content instead of being both missing and extra:
+
+Cyan    - the file lost its link but the content is the same
+Magenta - the file lost its link and the content diverged
+
+Paths after -- (relative to the input directory) limit the comparison to these subtrees.
+With --exit-code the command exits with 1 if there are differences.
 `,
+	Example: "driveignore diff ~/Drive/project --stat --exit-code -- docs src/main.go",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		vPrint := utils.VPrintWrapper(verbose)
-		redPrint := color.New(color.FgRed).PrintlnFunc()
-		yellowPrint := color.New(color.FgHiYellow).PrintlnFunc()
-
-		driveignore, driveignoreType := utils.DriveIgnore(diffInput, diffMergeIgnores)
-
-		switch driveignoreType {
-		case utils.GlobalIgnore:
-			vPrint("loaded global .driveignore")
-		case utils.LocalIgnore:
-			vPrint("loaded local .driveignore")
-		case utils.MergedIgnore:
-			vPrint("loaded merged global and local .driveignore")
-		case utils.NoIgnore:
-			return errors.New("No local nor global .driveignores found")
+		out, err := newReporter(diffOutput)
+		if err != nil {
+			return err
 		}
+		defer out.flush()
+		return out.reportError(runDiff(cmd, args, out))
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		args, _ = dashArgs(cmd, args)
+		return destinationArgs(&diffInput)(cmd, args)
+	},
+}
 
-		missing, old := make(chan string), make(chan string)
-
-		var err1, err2 error
-
-		// search for missing files
-		go func() {
-			err1 = utils.Walker(diffInput, func(currPath string, info os.FileInfo, relativePath string) error {
-				// ignore .driveignore files/dirs
-				if info.IsDir() && driveignore.Match(currPath, true) {
-					return filepath.SkipDir
-				} else if !info.IsDir() && driveignore.Match(currPath, false) {
-					return nil
-				}
-
-				// check if file/directory exists in drive sync folder
-				goalPath := filepath.Join(args[0], relativePath)
-				goalStat, err := os.Stat(goalPath)
-				if os.IsNotExist(err) || (!os.SameFile(info, goalStat) && !info.IsDir()) {
-					missing <- relativePath
-				}
-				return nil
-			})
-			close(missing)
-		}()
-
-		// search for legacy files/directories
-		go func() {
-			err2 = utils.Walker(args[0], func(currPath string, info os.FileInfo, relativePath string) error {
-				// check if file exists in input folder
-				inputPath := filepath.Join(diffInput, relativePath)
-				goalStat, err := os.Stat(inputPath)
-				if os.IsNotExist(err) || (!os.SameFile(info, goalStat) && !info.IsDir()) {
-					old <- relativePath
-				}
-				return nil
-			})
-			close(old)
-		}()
-
-		for m := range missing {
-			redPrint(m)
+// runDiff compares the input with the drive sync folder reporting the differences to out
+func runDiff(cmd *cobra.Command, args []string, out *reporter) error {
+	vPrint := out.vPrint()
+
+	if err := applySettings(cmd, diffInput); err != nil {
+		return err
+	}
+	args, filterArgs := dashArgs(cmd, args)
+	destination, err := destinationPath(diffInput, args)
+	if err != nil {
+		return err
+	}
+
+	driveignore, err := loadDriveIgnore(diffInput, utils.IgnoreOptions{MergeIgnores: diffMergeIgnores, UseGitignore: diffUseGitignore, Git: utils.GitMode(diffGit)}, vPrint)
+	if err != nil {
+		return err
+	}
+
+	walkOptions, err := parseWalkOptions(diffSymlinks, diffSymlinksOutside)
+	if err != nil {
+		return err
+	}
+
+	categories := []utils.DiffCategory{utils.DiffMissing, utils.DiffExtra}
+	if diffContent {
+		categories = append(categories, utils.DiffBroken, utils.DiffDiverged)
+	}
+	colors := map[utils.DiffCategory]func(...interface{}){
+		utils.DiffMissing:  color.New(color.FgRed).PrintlnFunc(),
+		utils.DiffExtra:    color.New(color.FgHiYellow).PrintlnFunc(),
+		utils.DiffBroken:   color.New(color.FgCyan).PrintlnFunc(),
+		utils.DiffDiverged: color.New(color.FgMagenta).PrintlnFunc(),
+	}
+	stats := map[utils.DiffCategory]*diffStat{}
+	for _, category := range categories {
+		stats[category] = &diffStat{}
+	}
+
+	found := 0
+	opts := utils.DiffOptions{WalkOptions: walkOptions, Paths: filterArgs, Content: diffContent}
+	err = utils.Diff(diffInput, destination, driveignore, opts, func(diff utils.Difference) error {
+		found++
+		stat := stats[diff.Category]
+		if !diff.Info.IsDir() {
+			stat.files++
+			stat.bytes += diff.Info.Size()
 		}
-		if err1 != nil {
-			return err1
+		if diffStats {
+			return nil
 		}
-		for o := range old {
-			yellowPrint(o)
+		if !out.machine() {
+			colors[diff.Category](diff.Path)
+			return nil
 		}
-		if err2 != nil {
-			return err2
+		rec := record{Op: string(diff.Category), Path: diff.Path}
+		rec.Source, _ = filepath.Abs(filepath.Join(diffInput, diff.Path))
+		rec.Destination, _ = filepath.Abs(filepath.Join(destination, diff.Path))
+		if !diff.Info.IsDir() {
+			rec.Size = diff.Info.Size()
 		}
+		out.report(rec)
 		return nil
-	},
-	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 1 {
-			return errors.New("There should only be one argument")
-		}
-		fstat, err := os.Stat(args[0])
-		if os.IsNotExist(err) {
-			return errors.New("Passed path doesnt exist")
+	})
+	if err != nil {
+		return err
+	}
+
+	if diffStats {
+		for _, category := range categories {
+			stat := stats[category]
+			if out.machine() {
+				out.report(record{Op: "stat", Category: string(category), Count: stat.files, Size: stat.bytes})
+			} else {
+				fmt.Printf("%s: %d files, %d bytes\n", category, stat.files, stat.bytes)
+			}
 		}
-		if !fstat.IsDir() {
-			return errors.New("Passed path isnt a directory")
-		}
-		return nil
-	},
+	}
+
+	if diffExitCode && found > 0 {
+		exitCode = exitDifferences
+	}
+	return nil
+}
+
+// diffStat sums up the files of a category for --stat
+type diffStat struct {
+	files int
+	bytes int64
 }
 
 var diffInput string
 var diffMergeIgnores bool
+var diffUseGitignore bool
+var diffGit string
+var diffSymlinks string
+var diffSymlinksOutside bool
+var diffOutput string
+var diffExitCode bool
+var diffStats bool
+var diffContent bool
 
 func init() {
 	rootCmd.AddCommand(diffCmd)
@@ -129,4 +164,12 @@ func init() {
 	// Local flags
 	diffCmd.Flags().StringVarP(&diffInput, "input", "i", ".", "Input directory of the files to be compared")
 	diffCmd.Flags().BoolVarP(&diffMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	diffCmd.Flags().BoolVar(&diffUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	diffCmd.Flags().StringVar(&diffGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	diffCmd.Flags().StringVar(&diffSymlinks, "symlinks", string(utils.SymlinksPreserve), "What is done with symlinks: preserve, follow, skip or copy-target")
+	diffCmd.Flags().BoolVar(&diffSymlinksOutside, "symlinks-outside", false, "Allows following symlinks that point outside of the input directory")
+	diffCmd.Flags().BoolVar(&diffExitCode, "exit-code", false, "Exits with 1 if there are differences and 0 otherwise")
+	diffCmd.Flags().BoolVar(&diffContent, "content", false, "Compares the content of files that are no longer linked")
+	diffCmd.Flags().BoolVar(&diffStats, "stat", false, "Prints the amount of files and bytes of each category instead of the paths")
+	diffCmd.Flags().StringVar(&diffOutput, "output", outputText, "Output format: text, json or ndjson")
 }
@@ -33,8 +33,14 @@ var globalCmd = &cobra.Command{
 	Long: `If you wish to have a global .driveignore you can set the content of to it here.
 You can later decide if you want to use global, local or merged .driveignore.`,
 	Example: "vim $(driveignore global)",
-	RunE:    globalRun(utils.GlobalDriveignorePath()),
-	Args:    globalArg,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := utils.GlobalDriveignorePath()
+		if err != nil {
+			return err
+		}
+		return globalRun(path)(cmd, args)
+	},
+	Args: globalArg,
 }
 
 var (
@@ -43,17 +49,35 @@ var (
 
 func globalRun(globalDriveignorePath string) func(cmd *cobra.Command, args []string) error {
 	return func(cmd *cobra.Command, args []string) error {
-		vPrint := utils.VPrintWrapper(verbose)
+		out, err := newReporter(globalOutput)
+		if err != nil {
+			return err
+		}
+		defer out.flush()
+		vPrint := out.vPrint()
 
 		if _, err := os.Stat(globalDriveignorePath); os.IsNotExist(err) {
 			os.MkdirAll(filepath.Dir(globalDriveignorePath), os.ModePerm)
-			err := ioutil.WriteFile(globalDriveignorePath, []byte{}, os.ModePerm)
-			if err != nil {
-				return nil
+			// the one kept next to the sources by older versions is moved over
+			legacy := utils.LegacyGlobalDriveignorePath()
+			content, err := ioutil.ReadFile(legacy)
+			if err != nil && !os.IsNotExist(err) {
+				return out.reportError(err)
+			}
+			if err := ioutil.WriteFile(globalDriveignorePath, content, os.ModePerm); err != nil {
+				return out.reportError(err)
+			}
+			if content != nil {
+				vPrint(".global_driveignore didnt exist, copied the one from", legacy)
+			} else {
+				vPrint(".global_driveignore didnt exist, created a new one")
 			}
-			vPrint(".global_driveignore didnt exist, created a new one")
 		}
 
+		if out.machine() {
+			out.report(record{Op: "global", Path: globalDriveignorePath})
+			return nil
+		}
 		fmt.Println(globalDriveignorePath)
 		return nil
 	}
@@ -66,6 +90,11 @@ func globalArg(_ *cobra.Command, args []string) error {
 	return nil
 }
 
+var globalOutput string
+
 func init() {
 	rootCmd.AddCommand(globalCmd)
+
+	// Local flags
+	globalCmd.Flags().StringVar(&globalOutput, "output", outputText, "Output format: text, json or ndjson")
 }
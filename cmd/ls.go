@@ -0,0 +1,106 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+// lsCmd represents the ls command
+var lsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Lists the files that would be uploaded",
+	Long: `Walks through the input directory (can be overwritten with --input flag)
+with respect to the .driveignores and prints every file and directory
+that would end up in the drive sync folder. Nothing is modified.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose)
+
+		walkOptions, err := parseWalkOptions(lsSymlinks, lsSymlinksOutside)
+		if err != nil {
+			return err
+		}
+		driveignore, err := loadDriveIgnore(lsInput, utils.IgnoreOptions{MergeIgnores: lsMergeIgnores, UseGitignore: lsUseGitignore, Git: utils.GitMode(lsGit)}, vPrint)
+		if err != nil {
+			return err
+		}
+
+		var files, dirs int
+		var total int64
+		err = utils.IgnoreWalker(lsInput, driveignore, walkOptions, nil, func(currPath string, info os.FileInfo, relativePath string) error {
+			if info.IsDir() {
+				dirs++
+				if lsSize {
+					fmt.Printf("%12s  %s\n", "-", relativePath)
+				} else {
+					fmt.Println(relativePath)
+				}
+				return nil
+			}
+
+			files++
+			total += info.Size()
+			if lsSize {
+				fmt.Printf("%12d  %s\n", info.Size(), relativePath)
+			} else {
+				fmt.Println(relativePath)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if lsTotal {
+			fmt.Printf("total: %d files, %d directories, %d bytes\n", files, dirs, total)
+		}
+		return nil
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("There should be no arguments")
+		}
+		return nil
+	},
+}
+
+var lsInput string
+var lsMergeIgnores bool
+var lsUseGitignore bool
+var lsGit string
+var lsSize bool
+var lsTotal bool
+var lsSymlinks string
+var lsSymlinksOutside bool
+
+func init() {
+	rootCmd.AddCommand(lsCmd)
+
+	// Local flags
+	lsCmd.Flags().StringVarP(&lsInput, "input", "i", ".", "Input directory of the files to be listed")
+	lsCmd.Flags().BoolVarP(&lsMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	lsCmd.Flags().BoolVar(&lsUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	lsCmd.Flags().StringVar(&lsGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	lsCmd.Flags().StringVar(&lsSymlinks, "symlinks", string(utils.SymlinksPreserve), "What is done with symlinks: preserve, follow, skip or copy-target")
+	lsCmd.Flags().BoolVar(&lsSymlinksOutside, "symlinks-outside", false, "Allows following symlinks that point outside of the input directory")
+	lsCmd.Flags().BoolVarP(&lsSize, "size", "s", false, "Prints the size of every file in bytes")
+	lsCmd.Flags().BoolVar(&lsTotal, "total", false, "Prints the total amount of files, directories and bytes")
+}
@@ -0,0 +1,132 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/shilangyu/driveignore/utils"
+)
+
+// formats of --output
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+// record is a single result of a command in machine readable output
+type record struct {
+	Op          string `json:"op"`
+	Path        string `json:"path,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Count       int    `json:"count,omitempty"`
+	DryRun      bool   `json:"dryRun,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// reporter prints the results of a command in the --output format.
+// In text format the commands print on their own and nothing is reported
+type reporter struct {
+	format  string
+	records []record
+}
+
+// textOutput is the reporter of commands without --output
+var textOutput = &reporter{format: outputText}
+
+func newReporter(format string) (*reporter, error) {
+	switch format {
+	case outputText, outputJSON, outputNDJSON:
+		return &reporter{format: format, records: []record{}}, nil
+	}
+	return nil, &utils.ConfigError{Err: fmt.Errorf("Invalid output '%s', should be one of: text, json, ndjson", format)}
+}
+
+// machine reports whether the output is meant for programs
+func (r *reporter) machine() bool {
+	return r.format != outputText
+}
+
+// vPrint is the verbose printer, it writes to stderr in machine readable output
+func (r *reporter) vPrint() func(...interface{}) {
+	if !r.machine() {
+		return utils.VPrintWrapper(verbose)
+	}
+	if !verbose {
+		return func(...interface{}) {}
+	}
+	return func(data ...interface{}) {
+		fmt.Fprintln(os.Stderr, data...)
+	}
+}
+
+func (r *reporter) report(rec record) {
+	switch r.format {
+	case outputJSON:
+		r.records = append(r.records, rec)
+	case outputNDJSON:
+		data, _ := json.Marshal(rec)
+		fmt.Println(string(data))
+	}
+}
+
+// flush prints the records collected for json output
+func (r *reporter) flush() {
+	if r.format == outputJSON {
+		data, _ := json.MarshalIndent(r.records, "", "  ")
+		fmt.Println(string(data))
+	}
+}
+
+// reportError reports the error that stopped the command and passes it on.
+// Every failed operation is reported on its own followed by the summary
+func (r *reporter) reportError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var applyErr *utils.ApplyError
+	if !errors.As(err, &applyErr) {
+		r.report(record{Op: "error", Error: err.Error()})
+		return err
+	}
+	for _, failure := range applyErr.Failures {
+		r.report(record{Op: string(failure.Operation.Kind), Path: failure.Operation.Path, Error: failure.Err.Error()})
+	}
+	r.report(record{Op: "error", Error: applyErr.Summary()})
+	return err
+}
+
+// operationRecord describes an operation of the plan
+func operationRecord(plan *utils.Plan, op utils.Operation) record {
+	rec := record{Op: string(op.Kind), Path: op.Path}
+	if op.Kind != utils.OpRemove {
+		rec.Source, _ = filepath.Abs(filepath.Join(plan.Input, op.Path))
+	}
+	rec.Destination, _ = filepath.Abs(filepath.Join(plan.Destination, op.Path))
+	if op.Source != nil {
+		rec.Size = op.Source.Size
+	} else if op.Destination != nil {
+		rec.Size = op.Destination.Size
+	}
+	return rec
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_reporter(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{
+			name:   "text",
+			format: outputText,
+			want:   "",
+		},
+		{
+			name:   "ndjson",
+			format: outputNDJSON,
+			want: `{"op":"link","path":"a","size":3}
+{"op":"error","error":"Broken"}
+`,
+		},
+		{
+			name:   "json",
+			format: outputJSON,
+			want: `[
+  {
+    "op": "link",
+    "path": "a",
+    "size": 3
+  },
+  {
+    "op": "error",
+    "error": "Broken"
+  }
+]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			out, err := newReporter(tt.format)
+			req.NoError(err)
+
+			stdout, _ := utils.CatchOutput(func() {
+				out.report(record{Op: "link", Path: "a", Size: 3})
+				req.Error(out.reportError(errors.New("Broken")))
+				req.NoError(out.reportError(nil))
+				out.flush()
+			})
+			req.Equal(tt.want, stdout)
+		})
+	}
+
+	_, err := newReporter("xml")
+	require.Error(t, err)
+}
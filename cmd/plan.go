@@ -0,0 +1,122 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan [drive sync folder path]",
+	Short: "Computes the operations unify would perform",
+	Long: `Computes the full set of operations (mkdir, link, replace, remove) needed
+to mirror the input directory into the drive sync folder, exactly like unify would,
+and saves it as JSON so it can be reviewed before running 'driveignore apply'.
+`,
+	Example: "driveignore plan ~/Drive/project -o plan.json",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose)
+
+		if err := applySettings(cmd, planInput); err != nil {
+			return err
+		}
+		destination, err := destinationPath(planInput, args)
+		if err != nil {
+			return err
+		}
+
+		input, err := filepath.Abs(planInput)
+		if err != nil {
+			return err
+		}
+		destination, err = filepath.Abs(destination)
+		if err != nil {
+			return err
+		}
+
+		linkMode, err := utils.ParseLinkMode(planLinkMode)
+		if err != nil {
+			return err
+		}
+		walkOptions, err := parseWalkOptions(planSymlinks, planSymlinksOutside)
+		if err != nil {
+			return err
+		}
+		driveignore, err := loadDriveIgnore(input, utils.IgnoreOptions{MergeIgnores: planMergeIgnores, UseGitignore: planUseGitignore, Git: utils.GitMode(planGit)}, vPrint)
+		if err != nil {
+			return err
+		}
+
+		opts := utils.PlanOptions{
+			WalkOptions: walkOptions,
+			LinkMode:    linkMode,
+			Skipped:     skippedPrinter(vPrint),
+		}
+		if planCleanIgnored {
+			opts.Ignored = driveignore
+		}
+		plan, err := utils.PlanUnify(input, destination, driveignore, opts)
+		if err != nil {
+			return err
+		}
+		plan.MergeIgnores = planMergeIgnores
+		plan.UseGitignore = planUseGitignore
+		plan.Git = utils.GitMode(planGit)
+
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		if planOutput == "-" {
+			fmt.Println(string(data))
+			return nil
+		}
+		vPrint("planned", len(plan.Operations), "operations")
+		return ioutil.WriteFile(planOutput, append(data, '\n'), 0644)
+	},
+	Args: destinationArgs(&planInput),
+}
+
+var planInput string
+var planMergeIgnores bool
+var planUseGitignore bool
+var planGit string
+var planOutput string
+var planLinkMode string
+var planSymlinks string
+var planSymlinksOutside bool
+var planCleanIgnored bool
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+
+	// Local flags
+	planCmd.Flags().StringVarP(&planInput, "input", "i", ".", "Input directory of the files to be uploaded")
+	planCmd.Flags().BoolVarP(&planMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	planCmd.Flags().BoolVar(&planUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	planCmd.Flags().StringVar(&planGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	planCmd.Flags().StringVar(&planLinkMode, "link-mode", string(utils.LinkHard), "How files are put into the drive folder: hardlink, reflink, copy or auto")
+	planCmd.Flags().StringVar(&planSymlinks, "symlinks", string(utils.SymlinksPreserve), "What is done with symlinks: preserve, follow, skip or copy-target")
+	planCmd.Flags().BoolVar(&planSymlinksOutside, "symlinks-outside", false, "Allows following symlinks that point outside of the input directory")
+	planCmd.Flags().BoolVar(&planCleanIgnored, "clean-ignored", true, "Removes uploaded files that the .driveignores ignore by now")
+	planCmd.Flags().StringVarP(&planOutput, "output", "o", "-", "File the plan is saved to, - for stdout")
+}
@@ -0,0 +1,194 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manages the registry of directories to sync",
+	Long: `A profile is a named input directory together with the drive sync folder
+it is mirrored into, whether .driveignores are merged and the link mode.
+Profiles are kept next to the global .driveignore and synced with 'driveignore sync'.`,
+	Example: "driveignore profile add notes ~/Drive/notes -i ~/notes",
+}
+
+// profileAddCmd represents the profile add command
+var profileAddCmd = &cobra.Command{
+	Use:   "add [name] [drive sync folder path]",
+	Short: "Registers a new profile",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// the link mode and symlink policy are only pinned when given, otherwise the settings apply
+		var linkMode utils.LinkMode
+		var symlinks utils.SymlinkPolicy
+		var err error
+		if cmd.Flags().Changed("link-mode") {
+			if linkMode, err = utils.ParseLinkMode(profileLinkMode); err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("symlinks") {
+			if symlinks, err = utils.ParseSymlinkPolicy(profileSymlinks); err != nil {
+				return err
+			}
+		}
+		git, err := utils.ParseGitMode(profileGit)
+		if err != nil {
+			return err
+		}
+		input, err := filepath.Abs(profileInput)
+		if err != nil {
+			return err
+		}
+		destination, err := filepath.Abs(args[1])
+		if err != nil {
+			return err
+		}
+		if fstat, err := os.Stat(input); err != nil || !fstat.IsDir() {
+			return &utils.ConfigError{Err: errors.New("Input path isnt a directory")}
+		}
+
+		profiles, err := loadProfiles()
+		if err != nil {
+			return err
+		}
+		err = profiles.Add(utils.Profile{
+			Name:            args[0],
+			Input:           input,
+			Destination:     destination,
+			MergeIgnores:    profileMergeIgnores,
+			UseGitignore:    profileUseGitignore,
+			Git:             git,
+			LinkMode:        linkMode,
+			Symlinks:        symlinks,
+			SymlinksOutside: profileSymlinksOutside,
+		})
+		if err != nil {
+			return err
+		}
+		return profiles.Save()
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("There should be a name and a drive sync folder path")
+		}
+		fstat, err := os.Stat(args[1])
+		if os.IsNotExist(err) {
+			return errors.New("Passed path doesnt exist")
+		}
+		if !fstat.IsDir() {
+			return errors.New("Passed path isnt a directory")
+		}
+		return nil
+	},
+}
+
+// profileListCmd represents the profile list command
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Prints the registered profiles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := loadProfiles()
+		if err != nil {
+			return err
+		}
+		for _, profile := range profiles.Profiles {
+			flags := profile.Flags()
+			var options []string
+			for _, name := range []string{"link-mode", "merge-ignores", "use-gitignore", "git", "symlinks", "symlinks-outside"} {
+				if value, ok := flags[name]; ok && value == "true" {
+					options = append(options, name)
+				} else if ok {
+					options = append(options, name+"="+value)
+				}
+			}
+			if len(options) == 0 {
+				fmt.Printf("%s\t%s -> %s\n", profile.Name, profile.Input, profile.Destination)
+			} else {
+				fmt.Printf("%s\t%s -> %s (%s)\n", profile.Name, profile.Input, profile.Destination, strings.Join(options, ", "))
+			}
+		}
+		return nil
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("There should be no arguments")
+		}
+		return nil
+	},
+}
+
+// profileRemoveCmd represents the profile remove command
+var profileRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Unregisters a profile, no files are touched",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := loadProfiles()
+		if err != nil {
+			return err
+		}
+		if err := profiles.Remove(args[0]); err != nil {
+			return err
+		}
+		return profiles.Save()
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("There should only be one argument")
+		}
+		return nil
+	},
+}
+
+// loadProfiles loads the profiles registry kept next to the global .driveignore
+func loadProfiles() (*utils.Profiles, error) {
+	path, err := utils.ProfilesPath()
+	if err != nil {
+		return nil, err
+	}
+	return utils.LoadProfiles(path)
+}
+
+var profileInput string
+var profileMergeIgnores bool
+var profileUseGitignore bool
+var profileGit string
+var profileLinkMode string
+var profileSymlinks string
+var profileSymlinksOutside bool
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileAddCmd, profileListCmd, profileRemoveCmd)
+
+	// Local flags
+	profileAddCmd.Flags().StringVarP(&profileInput, "input", "i", ".", "Input directory of the files to be synced")
+	profileAddCmd.Flags().BoolVarP(&profileMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	profileAddCmd.Flags().BoolVar(&profileUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	profileAddCmd.Flags().StringVar(&profileGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	profileAddCmd.Flags().StringVar(&profileLinkMode, "link-mode", string(utils.LinkHard), "How files are put into the drive folder: hardlink, reflink, copy or auto")
+	profileAddCmd.Flags().StringVar(&profileSymlinks, "symlinks", string(utils.SymlinksPreserve), "What is done with symlinks: preserve, follow, skip or copy-target")
+	profileAddCmd.Flags().BoolVar(&profileSymlinksOutside, "symlinks-outside", false, "Allows following symlinks that point outside of the input directory")
+}
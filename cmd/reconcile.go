@@ -0,0 +1,98 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shilangyu/driveignore/utils"
+)
+
+// reconciliation is what upload, clean and unify do: plan the operations that mirror the input
+// directory into the drive sync folder and apply them. The commands only differ in its parts
+type reconciliation struct {
+	input           string
+	mergeIgnores    bool
+	useGitignore    bool
+	git             string
+	linkMode        string
+	symlinks        string
+	symlinksOutside bool
+	dryRun          bool
+	// upload links the input files, force replaces the conflicting ones
+	upload bool
+	force  bool
+	// clean removes the legacy entries, cleanIgnored the ignored ones as well
+	clean        bool
+	cleanIgnored bool
+}
+
+// run plans the whole reconciliation at once and applies it reporting the results to out.
+// The plan orders the operations: creates go first, then replaces and removals last
+func (r reconciliation) run(args []string, out *reporter) error {
+	vPrint := out.vPrint()
+
+	destination, err := destinationPath(r.input, args)
+	if err != nil {
+		return err
+	}
+	walkOptions, err := parseWalkOptions(r.symlinks, r.symlinksOutside)
+	if err != nil {
+		return err
+	}
+	opts := utils.PlanOptions{WalkOptions: walkOptions, Force: r.force}
+	ignoreOptions := utils.IgnoreOptions{MergeIgnores: r.mergeIgnores, UseGitignore: r.useGitignore, Git: utils.GitMode(r.git)}
+
+	var driveignore *utils.Ignorer
+	if r.upload || r.cleanIgnored {
+		if driveignore, err = loadDriveIgnore(r.input, ignoreOptions, vPrint); err != nil {
+			return err
+		}
+		opts.Skipped = skippedPrinter(vPrint)
+		if r.cleanIgnored {
+			opts.Ignored = driveignore
+		}
+	}
+	if r.upload {
+		if opts.LinkMode, err = utils.ParseLinkMode(r.linkMode); err != nil {
+			return err
+		}
+		if r.force && !r.clean {
+			vPrint("Using --force, hope you know what are you doing")
+		}
+	}
+
+	var plan *utils.Plan
+	switch {
+	case r.upload && r.clean:
+		plan, err = utils.PlanUnify(r.input, destination, driveignore, opts)
+	case r.upload:
+		plan, err = utils.PlanUpload(r.input, destination, driveignore, opts)
+	default:
+		plan, err = utils.PlanClean(r.input, destination, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, conflict := range plan.Conflicts {
+		if out.machine() {
+			out.report(record{Op: "conflict", Path: conflict, Error: "A file with the same name already exists"})
+		} else {
+			fmt.Printf("cannot upload '%s'. A file with the same name already exists.\n", conflict)
+		}
+	}
+	return applyPlan(plan, r.dryRun, out, vPrint)
+}
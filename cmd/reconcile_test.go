@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_reconciliation(t *testing.T) {
+	req := require.New(t)
+	config, err := ioutil.TempDir("", "driveignore_Test_reconciliation_config")
+	req.NoError(err)
+	defer os.RemoveAll(config)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", config)
+
+	tests := []struct {
+		name    string
+		upload  bool
+		clean   bool
+		present []string
+		absent  []string
+	}{
+		{"upload", true, false, []string{"new", "old"}, nil},
+		{"clean", false, true, nil, []string{"new", "old"}},
+		{"unify", true, true, []string{"new"}, []string{"old"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			input, err := ioutil.TempDir("", "driveignore_Test_reconciliation_input")
+			req.NoError(err)
+			defer os.RemoveAll(input)
+			destination, err := ioutil.TempDir("", "driveignore_Test_reconciliation_destination")
+			req.NoError(err)
+			defer os.RemoveAll(destination)
+
+			req.NoError(ioutil.WriteFile(filepath.Join(input, utils.IgnoreFileName), []byte("*.log\n"), os.ModePerm))
+			req.NoError(ioutil.WriteFile(filepath.Join(input, "old"), []byte("1"), os.ModePerm))
+			r := reconciliation{input: input, linkMode: string(utils.LinkHard), symlinks: string(utils.SymlinksPreserve)}
+			first := r
+			first.upload = true
+			req.NoError(first.run([]string{destination}, textOutput))
+			req.NoError(os.Remove(filepath.Join(input, "old")))
+			req.NoError(ioutil.WriteFile(filepath.Join(input, "new"), []byte("2"), os.ModePerm))
+
+			r.upload, r.clean, r.force = tt.upload, tt.clean, tt.upload
+			utils.CatchOutput(func() {
+				req.NoError(r.run([]string{destination}, textOutput))
+			})
+			for _, name := range tt.present {
+				_, err := os.Stat(filepath.Join(destination, name))
+				req.NoError(err, name)
+			}
+			for _, name := range tt.absent {
+				_, err := os.Stat(filepath.Join(destination, name))
+				req.True(os.IsNotExist(err), name)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+// repairCmd represents the repair command
+var repairCmd = &cobra.Command{
+	Use:   "repair [drive sync folder path]",
+	Short: "Links again files whose hard link got broken",
+	Long: `Many editors save a file by writing a new one and renaming it over the old one,
+and Drive sometimes replaces files too. Either way the file in the drive sync folder
+no longer shares its content with the input file.
+
+Repair finds such files and links them again. Files with the same content are
+always linked again (unless --check-content=false), the ones that diverged are
+handled with --prefer:
+
+none   - they are only reported
+source - the input file wins, changes made in the drive sync folder are lost
+newer  - the file modified last wins, a newer drive file replaces the input file
+`,
+	Example: "driveignore repair ~/Drive/project --prefer=source",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose)
+
+		if err := applySettings(cmd, repairInput); err != nil {
+			return err
+		}
+		destination, err := destinationPath(repairInput, args)
+		if err != nil {
+			return err
+		}
+
+		prefer, err := utils.ParseRepairPolicy(repairPrefer)
+		if err != nil {
+			return err
+		}
+		driveignore, err := loadDriveIgnore(repairInput, utils.IgnoreOptions{MergeIgnores: repairMergeIgnores, UseGitignore: repairUseGitignore, Git: utils.GitMode(repairGit)}, vPrint)
+		if err != nil {
+			return err
+		}
+
+		plan, err := utils.PlanRepair(repairInput, destination, driveignore, prefer, repairCheckContent, utils.PlanOptions{
+			WalkOptions: utils.WalkOptions{Jobs: jobs},
+		})
+		if err != nil {
+			return err
+		}
+		for _, conflict := range plan.Conflicts {
+			fmt.Printf("cannot repair '%s'. The files diverged, pick a side with --prefer.\n", conflict)
+		}
+
+		return applyPlan(plan, repairDryRun, textOutput, vPrint)
+	},
+	Args: destinationArgs(&repairInput),
+}
+
+var repairInput string
+var repairMergeIgnores bool
+var repairUseGitignore bool
+var repairGit string
+var repairCheckContent bool
+var repairPrefer string
+var repairDryRun bool
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+
+	// Local flags
+	repairCmd.Flags().StringVarP(&repairInput, "input", "i", ".", "Input directory of the files to be repaired")
+	repairCmd.Flags().BoolVarP(&repairMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	repairCmd.Flags().BoolVar(&repairUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	repairCmd.Flags().StringVar(&repairGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	repairCmd.Flags().BoolVar(&repairCheckContent, "check-content", true, "Links again files with the same content regardless of --prefer")
+	repairCmd.Flags().StringVar(&repairPrefer, "prefer", string(utils.RepairNone), "What to do with diverged files: none, source or newer")
+	repairCmd.Flags().BoolVar(&repairDryRun, "dry-run", false, "Prints what would be done without touching the filesystem")
+}
@@ -15,9 +15,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/shilangyu/driveignore/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -29,18 +32,185 @@ var rootCmd = &cobra.Command{
 It will look for a .driveignore, ignore the specified files
 and make a hard link of your files to your drivesync folder
 meaning no files duplicates, and no repetitive cli calls.`,
+	// errors are printed by Execute which also picks the exit code
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
 var verbose bool
+var jobs int
+
+// exit codes so that automation can tell the outcomes apart
+const (
+	exitOK = iota
+	// exitDifferences is used by diff --exit-code and by check-ignore when no rule matched
+	exitDifferences
+	// exitFailure means that the command failed as a whole
+	exitFailure
+	// exitPartial means that some of the work failed, the rest is done
+	exitPartial
+	// exitConfig means invalid arguments, flags, settings or .driveignores
+	exitConfig
+)
+
+// exitCode is the exit status of a command that succeeded but still has something to signal
+var exitCode = exitOK
+
+// partialError is returned by commands when only some of their work failed
+type partialError struct {
+	error
+}
+
+// Partial is implemented by all errors of partial failures
+func (partialError) Partial() bool {
+	return true
+}
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	configArgs(rootCmd)
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		os.Exit(exitCode)
+	}
+
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	var configErr *utils.ConfigError
+	var partial interface{ Partial() bool }
+	switch {
+	case errors.As(err, &configErr):
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+		os.Exit(exitConfig)
+	case errors.As(err, &partial) && partial.Partial():
+		os.Exit(exitPartial)
+	}
+	os.Exit(exitFailure)
+}
+
+// configArgs makes the argument validation errors of cmd and its children configuration errors
+func configArgs(cmd *cobra.Command) {
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(cmd *cobra.Command, args []string) error {
+			if err := validate(cmd, args); err != nil {
+				return &utils.ConfigError{Err: err}
+			}
+			return nil
+		}
+	}
+	for _, child := range cmd.Commands() {
+		configArgs(child)
+	}
+}
+
+// loadDriveIgnore loads the .driveignores (and the git rules opts asks for)
+// of the input directory and reports which ones were taken
+func loadDriveIgnore(input string, opts utils.IgnoreOptions, vPrint func(...interface{})) (*utils.Ignorer, error) {
+	driveignore, driveignoreType, err := utils.DriveIgnore(input, opts)
+	if err != nil {
+		return nil, err
+	}
+	if driveignore == nil {
+		return nil, &utils.ConfigError{Err: errors.New("No local nor global .driveignores found")}
+	}
+
+	switch driveignoreType {
+	case utils.GlobalIgnore:
+		vPrint("loaded global .driveignore")
+	case utils.LocalIgnore:
+		vPrint("loaded local .driveignore")
+	case utils.MergedIgnore:
+		vPrint("loaded merged global and local .driveignore")
+	}
+	if opts.UseGitignore {
+		vPrint("loaded .gitignores and git exclude files")
+	}
+	if opts.Git != utils.GitAll {
+		vPrint("loaded git index, taking", opts.Git, "files")
+	}
+	return driveignore, nil
+}
+
+// parseWalkOptions validates the symlink flags of a command, left out entries are warned about on stderr
+func parseWalkOptions(symlinks string, symlinksOutside bool) (utils.WalkOptions, error) {
+	policy, err := utils.ParseSymlinkPolicy(symlinks)
+	if err != nil {
+		return utils.WalkOptions{}, err
+	}
+	return utils.WalkOptions{Symlinks: policy, SymlinksOutside: symlinksOutside, Jobs: jobs, Warn: warn}, nil
+}
+
+// warn prints a problem that does not stop the command
+func warn(err error) {
+	fmt.Fprintln(os.Stderr, "Warning:", err)
+}
+
+// destinationPath returns the drive sync folder passed as the argument or pinned by the settings file of input
+func destinationPath(input string, args []string) (string, error) {
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	settings, err := utils.LoadSettings(input)
+	if err != nil {
+		return "", err
+	}
+	if settings.Destination == "" {
+		return "", &utils.ConfigError{Err: errors.New("There should only be one argument or a destination in " + utils.SettingsFileName)}
+	}
+	return settings.Destination, nil
+}
+
+// destinationArgs validates the drive sync folder argument, it can be left out
+// when the settings file of input pins the destination
+func destinationArgs(input *string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return errors.New("There should only be one argument")
+		}
+		path, err := destinationPath(*input, args)
+		if err != nil {
+			return err
+		}
+		fstat, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return errors.New("Passed path doesnt exist")
+		}
+		if !fstat.IsDir() {
+			return errors.New("Passed path isnt a directory")
+		}
+		return nil
+	}
+}
+
+// dashArgs splits args into the ones before and after --
+func dashArgs(cmd *cobra.Command, args []string) ([]string, []string) {
+	if at := cmd.ArgsLenAtDash(); at >= 0 {
+		return args[:at], args[at:]
+	}
+	return args, nil
+}
+
+// applySettings sets the flags of cmd that were not passed explicitly to the values
+// pinned by the settings file of input
+func applySettings(cmd *cobra.Command, input string) error {
+	settings, err := utils.LoadSettings(input)
+	if err != nil {
+		return err
+	}
+	for name, value := range settings.Flags() {
+		if flag := cmd.Flags().Lookup(name); flag != nil && !flag.Changed {
+			if err := flag.Value.Set(value); err != nil {
+				return &utils.ConfigError{Err: fmt.Errorf("Invalid %s in %s: %v", name, utils.SettingsFileName, err)}
+			}
+		}
 	}
+	return nil
 }
 
 func init() {
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &utils.ConfigError{Err: err}
+	})
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Prints out whats happening")
+	rootCmd.PersistentFlags().IntVarP(&jobs, "jobs", "j", 0, "Amount of directories read and files linked at once, 0 uses all CPUs")
+	rootCmd.PersistentFlags().DurationVar(&trashTTL, "trash-ttl", 30*24*time.Hour, "How long removed entries are kept in the trash, 0 keeps them forever")
 }
@@ -0,0 +1,126 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status [drive sync folder path]",
+	Short: "Summarizes how the drive folder differs from the input",
+	Long: `Sorts every file and directory of the input and the drive sync folder into:
+
+in sync                       - the drive folder has the same file
+missing from drive folder     - it was never uploaded
+extra in drive folder         - it does not exist in the input anymore
+link broken, content equal    - the hard link got broken but nothing changed, see 'driveignore repair'
+link broken, content diverged - the hard link got broken and one of the files was edited
+newly ignored                 - it got uploaded before a .driveignore started to ignore it
+
+Files that are no longer linked are compared like 'driveignore diff --content' does,
+by size and then a hash of their content, --content compares them byte for byte instead.
+
+With --porcelain only the paths that are not in sync are printed, one per line
+prefixed with the state code: M, E, B, D or I.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose && !statusPorcelain)
+
+		if err := applySettings(cmd, statusInput); err != nil {
+			return err
+		}
+		destination, err := destinationPath(statusInput, args)
+		if err != nil {
+			return err
+		}
+
+		walkOptions, err := parseWalkOptions(statusSymlinks, statusSymlinksOutside)
+		if err != nil {
+			return err
+		}
+		driveignore, err := loadDriveIgnore(statusInput, utils.IgnoreOptions{MergeIgnores: statusMergeIgnores, UseGitignore: statusUseGitignore, Git: utils.GitMode(statusGit)}, vPrint)
+		if err != nil {
+			return err
+		}
+
+		entries, err := utils.Status(statusInput, destination, driveignore, walkOptions, statusContent)
+		if err != nil {
+			return err
+		}
+
+		if statusPorcelain {
+			for _, entry := range entries {
+				if entry.State != utils.StateInSync {
+					fmt.Println(entry.State.Code(), entry.Path)
+				}
+			}
+			return nil
+		}
+
+		colors := map[utils.SyncState]*color.Color{
+			utils.StateMissing:  color.New(color.FgRed),
+			utils.StateExtra:    color.New(color.FgHiYellow),
+			utils.StateBroken:   color.New(color.FgCyan),
+			utils.StateDiverged: color.New(color.FgMagenta),
+			utils.StateIgnored:  color.New(color.FgHiBlack),
+		}
+		for _, state := range utils.SyncStates {
+			var paths []string
+			for _, entry := range entries {
+				if entry.State == state {
+					paths = append(paths, entry.Path)
+				}
+			}
+			fmt.Printf("%s: %d\n", state, len(paths))
+			if state == utils.StateInSync {
+				continue
+			}
+			for _, path := range paths {
+				colors[state].Println("\t" + path)
+			}
+		}
+		return nil
+	},
+	Args: destinationArgs(&statusInput),
+}
+
+var statusInput string
+var statusMergeIgnores bool
+var statusUseGitignore bool
+var statusGit string
+var statusPorcelain bool
+var statusContent bool
+var statusSymlinks string
+var statusSymlinksOutside bool
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	// Local flags
+	statusCmd.Flags().StringVarP(&statusInput, "input", "i", ".", "Input directory of the files to be compared")
+	statusCmd.Flags().BoolVarP(&statusMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	statusCmd.Flags().BoolVar(&statusUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	statusCmd.Flags().StringVar(&statusGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	statusCmd.Flags().BoolVar(&statusPorcelain, "porcelain", false, "Prints the paths that are not in sync in a stable, machine readable format")
+	statusCmd.Flags().BoolVar(&statusContent, "content", false, "Compares files that are no longer linked byte for byte instead of by a hash of their content")
+	statusCmd.Flags().StringVar(&statusSymlinks, "symlinks", string(utils.SymlinksPreserve), "What is done with symlinks: preserve, follow, skip or copy-target")
+	statusCmd.Flags().BoolVar(&statusSymlinksOutside, "symlinks-outside", false, "Allows following symlinks that point outside of the input directory")
+}
@@ -0,0 +1,111 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync [profile name]",
+	Short: "Unifies the directories of registered profiles",
+	Long: `Runs 'driveignore unify' for a profile registered with 'driveignore profile add'
+or for all of them with --all. A failing profile does not stop the other ones.`,
+	Example: "driveignore sync --all",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose)
+
+		profiles, err := loadProfiles()
+		if err != nil {
+			return err
+		}
+		toSync := profiles.Profiles
+		if !syncAll {
+			profile := profiles.Get(args[0])
+			if profile == nil {
+				return &utils.ConfigError{Err: fmt.Errorf("Profile '%s' doesnt exist", args[0])}
+			}
+			toSync = []utils.Profile{*profile}
+		}
+
+		failed := 0
+		for _, profile := range toSync {
+			vPrint("syncing", profile.Name)
+			if err := syncProfile(profile, syncDryRun); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", profile.Name, err)
+				failed++
+			}
+		}
+		if failed == 0 {
+			return nil
+		}
+		err = fmt.Errorf("Syncing %d of %d profiles failed", failed, len(toSync))
+		if failed < len(toSync) {
+			return partialError{err}
+		}
+		return err
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if syncAll && len(args) != 0 {
+			return errors.New("There should be no arguments with --all")
+		}
+		if !syncAll && len(args) != 1 {
+			return errors.New("There should only be one argument")
+		}
+		return nil
+	},
+}
+
+// syncProfile unifies the input directory of the profile with its drive folder the way unify does.
+// The options the profile pins take precedence over the project settings of its input directory
+func syncProfile(profile utils.Profile, dryRun bool) error {
+	if fstat, err := os.Stat(profile.Destination); err != nil || !fstat.IsDir() {
+		return fmt.Errorf("Drive sync folder '%s' isnt a directory", profile.Destination)
+	}
+	r := reconciliation{input: profile.Input, dryRun: dryRun, upload: true, force: true, clean: true, cleanIgnored: true}
+	options := &cobra.Command{}
+	options.Flags().BoolVar(&r.mergeIgnores, "merge-ignores", false, "")
+	options.Flags().BoolVar(&r.useGitignore, "use-gitignore", false, "")
+	options.Flags().StringVar(&r.git, "git", "", "")
+	options.Flags().StringVar(&r.linkMode, "link-mode", string(utils.LinkHard), "")
+	options.Flags().StringVar(&r.symlinks, "symlinks", string(utils.SymlinksPreserve), "")
+	options.Flags().BoolVar(&r.symlinksOutside, "symlinks-outside", false, "")
+	for name, value := range profile.Flags() {
+		if err := options.Flags().Set(name, value); err != nil {
+			return &utils.ConfigError{Err: fmt.Errorf("Invalid %s of profile '%s': %v", name, profile.Name, err)}
+		}
+	}
+	if err := applySettings(options, profile.Input); err != nil {
+		return err
+	}
+	return r.run([]string{profile.Destination}, textOutput)
+}
+
+var syncAll bool
+var syncDryRun bool
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	// Local flags
+	syncCmd.Flags().BoolVar(&syncAll, "all", false, "Syncs every registered profile")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Prints what would be done without touching the filesystem")
+}
@@ -0,0 +1,152 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+// trashCmd represents the trash command
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manages the entries removed from drive sync folders",
+	Long: `Instead of being deleted, entries removed by clean (and every other command
+removing or replacing files) are moved to the trash kept next to the global .driveignore.
+Every run gets its own dated entry which can be restored or purged.
+Entries older than --trash-ttl are purged automatically.`,
+	Example: "driveignore trash restore 20191018-150405",
+}
+
+// trashListCmd represents the trash list command
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Prints the entries of the trash",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		trash, err := openTrash()
+		if err != nil {
+			return err
+		}
+		entries, err := trash.Entries()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			fmt.Printf("%s\t%s\t%d removed\n", entry.ID, entry.Destination, len(entry.Paths))
+			if verbose {
+				for _, path := range entry.Paths {
+					fmt.Println("\t" + path)
+				}
+			}
+		}
+		return nil
+	},
+	Args: globalArg,
+}
+
+// trashRestoreCmd represents the trash restore command
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore [id] [paths...]",
+	Short: "Moves removed entries back into their drive sync folder",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose)
+
+		trash, err := openTrash()
+		if err != nil {
+			return err
+		}
+		restored, err := trash.Restore(args[0], args[1:])
+		for _, path := range restored {
+			vPrint("restored:", path)
+		}
+		return err
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.New("There should be the id of a trash entry")
+		}
+		return nil
+	},
+}
+
+// trashPurgeCmd represents the trash purge command
+var trashPurgeCmd = &cobra.Command{
+	Use:   "purge [ids...]",
+	Short: "Permanently deletes entries of the trash",
+	Long: `Permanently deletes the trash entries with the given ids.
+Without ids either --all or --older-than has to be used.`,
+	Example: "driveignore trash purge --older-than 168h",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose)
+
+		trash, err := openTrash()
+		if err != nil {
+			return err
+		}
+		purged, err := trash.Purge(args, trashOlderThan)
+		for _, entry := range purged {
+			vPrint("purged:", entry.ID)
+		}
+		return err
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 && trashPurgeAll {
+			return errors.New("There should be no ids with --all")
+		}
+		if len(args) == 0 && !trashPurgeAll && trashOlderThan <= 0 {
+			return errors.New("There should be the ids of trash entries, --all or --older-than")
+		}
+		return nil
+	},
+}
+
+// openTrash returns the trash kept next to the global .driveignore
+func openTrash() (utils.Trash, error) {
+	path, err := utils.TrashPath()
+	return utils.Trash{Path: path, Warn: warn}, err
+}
+
+// expireTrash purges the trash entries older than --trash-ttl
+func expireTrash(vPrint func(...interface{})) error {
+	if trashTTL <= 0 {
+		return nil
+	}
+	trash, err := openTrash()
+	if err != nil {
+		return err
+	}
+	purged, err := trash.Purge(nil, trashTTL)
+	for _, entry := range purged {
+		vPrint("purged expired trash entry:", entry.ID)
+	}
+	return err
+}
+
+var trashTTL time.Duration
+var trashOlderThan time.Duration
+var trashPurgeAll bool
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashPurgeCmd)
+
+	// Local flags
+	trashPurgeCmd.Flags().DurationVar(&trashOlderThan, "older-than", 0, "Purges only the entries older than that")
+	trashPurgeCmd.Flags().BoolVar(&trashPurgeAll, "all", false, "Purges every entry of the trash")
+}
@@ -15,9 +15,7 @@
 package cmd
 
 import (
-	"errors"
-	"os"
-
+	"github.com/shilangyu/driveignore/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -28,48 +26,47 @@ var unifyCmd = &cobra.Command{
 	Long: `Uploads all files (with respect to .driveignores)
 aswell as removes legacy files from the drive sync folder.
 
-Its an alias for: 'driveignore upload [args] [flags] --force' + 'driveignore clean [args] [flags]'`,
+Its upload --force and clean --ignored in one go, except that all operations are planned
+up front and performed in a safe order: creates first, then replaces and removals last.
+Turn off the removal of ignored files with --clean-ignored=false.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// set flags
-		uploadForce = true
-		uploadMergeIgnores = unifyMergeIgnores
-		uploadInput = unifyInput
-		cleanInput = unifyInput
-
-		// call commands
-		errs := make(chan error, 2)
-		go func() {
-			errs <- uploadCmd.RunE(cmd, args)
-		}()
-		go func() {
-			errs <- cleanCmd.RunE(cmd, args)
-		}()
-
-		for i := 0; i < cap(errs); i++ {
-			if err := <-errs; err != nil {
-				return err
-			}
+		out, err := newReporter(unifyOutput)
+		if err != nil {
+			return err
 		}
+		defer out.flush()
 
-		return nil
-	},
-	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 1 {
-			return errors.New("There should only be one argument")
-		}
-		fstat, err := os.Stat(args[0])
-		if os.IsNotExist(err) {
-			return errors.New("Passed path doesnt exist")
-		}
-		if !fstat.IsDir() {
-			return errors.New("Passed path isnt a directory")
+		if err := applySettings(cmd, unifyInput); err != nil {
+			return out.reportError(err)
 		}
-		return nil
+		return out.reportError(reconciliation{
+			input:           unifyInput,
+			mergeIgnores:    unifyMergeIgnores,
+			useGitignore:    unifyUseGitignore,
+			git:             unifyGit,
+			linkMode:        unifyLinkMode,
+			symlinks:        unifySymlinks,
+			symlinksOutside: unifySymlinksOutside,
+			dryRun:          unifyDryRun,
+			upload:          true,
+			force:           true,
+			clean:           true,
+			cleanIgnored:    unifyCleanIgnored,
+		}.run(args, out))
 	},
+	Args: destinationArgs(&unifyInput),
 }
 
 var unifyInput string
 var unifyMergeIgnores bool
+var unifyUseGitignore bool
+var unifyGit string
+var unifyDryRun bool
+var unifyLinkMode string
+var unifySymlinks string
+var unifySymlinksOutside bool
+var unifyOutput string
+var unifyCleanIgnored bool
 
 func init() {
 	rootCmd.AddCommand(unifyCmd)
@@ -77,4 +74,12 @@ func init() {
 	// local flags
 	unifyCmd.Flags().StringVarP(&unifyInput, "input", "i", ".", "Input directory of the files to be uploaded")
 	unifyCmd.Flags().BoolVarP(&unifyMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	unifyCmd.Flags().BoolVar(&unifyUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	unifyCmd.Flags().StringVar(&unifyGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	unifyCmd.Flags().StringVar(&unifyLinkMode, "link-mode", string(utils.LinkHard), "How files are put into the drive folder: hardlink, reflink, copy or auto")
+	unifyCmd.Flags().StringVar(&unifySymlinks, "symlinks", string(utils.SymlinksPreserve), "What is done with symlinks: preserve, follow, skip or copy-target")
+	unifyCmd.Flags().BoolVar(&unifySymlinksOutside, "symlinks-outside", false, "Allows following symlinks that point outside of the input directory")
+	unifyCmd.Flags().BoolVar(&unifyCleanIgnored, "clean-ignored", true, "Removes uploaded files that the .driveignores ignore by now")
+	unifyCmd.Flags().StringVar(&unifyOutput, "output", outputText, "Output format: text, json or ndjson")
+	unifyCmd.Flags().BoolVar(&unifyDryRun, "dry-run", false, "Prints what would be done without touching the filesystem")
 }
@@ -15,11 +15,6 @@
 package cmd
 
 import (
-	"errors"
-	"fmt"
-	"os"
-	"path/filepath"
-
 	"github.com/shilangyu/driveignore/utils"
 	"github.com/spf13/cobra"
 )
@@ -34,87 +29,41 @@ The order of importance of a .driveignore file:
 current folder > global config
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		vPrint := utils.VPrintWrapper(verbose)
-
-		if uploadForce {
-			vPrint("Using --force, hope you know what are you doing")
-		}
-
-		driveignore, driveignoreType := utils.DriveIgnore(uploadInput, uploadMergeIgnores)
-
-		switch driveignoreType {
-		case utils.GlobalIgnore:
-			vPrint("loaded global .driveignore")
-		case utils.LocalIgnore:
-			vPrint("loaded local .driveignore")
-		case utils.MergedIgnore:
-			vPrint("loaded merged global and local .driveignore")
-		case utils.NoIgnore:
-			return errors.New("No local nor global .driveignores found")
+		out, err := newReporter(uploadOutput)
+		if err != nil {
+			return err
 		}
+		defer out.flush()
 
-		err := utils.Walker(uploadInput, func(currPath string, info os.FileInfo, relativePath string) error {
-			// ignore .driveignore files/dirs
-			if info.IsDir() && driveignore.Match(currPath, true) {
-				vPrint("skipped directory:", relativePath)
-				return filepath.SkipDir
-			} else if !info.IsDir() && driveignore.Match(currPath, false) {
-				vPrint("skipped file:", relativePath)
-				return nil
-			}
-
-			// if same name file already exists, check if its the same hardlink, then ignore
-			// else if not, create hardlink
-			// if its a directory, create one if doesnt yet exist
-			goalPath := filepath.Join(args[0], relativePath)
-			goalStat, err := os.Stat(goalPath)
-			currPathStat, _ := os.Stat(currPath)
-			sameNameDiffFile := false
-			if !info.IsDir() && !os.IsNotExist(err) && !os.SameFile(currPathStat, goalStat) {
-				if uploadForce {
-					sameNameDiffFile = true
-					os.Remove(goalPath)
-					vPrint("overwritting a file with same name:")
-				} else {
-					fmt.Printf("cannot upload '%s'. A file with the same name already exists.\n", relativePath)
-				}
-			}
-			if os.IsNotExist(err) || sameNameDiffFile {
-				err = os.MkdirAll(filepath.Dir(goalPath), os.ModePerm)
-				if err != nil {
-					panic(err)
-				}
-				vPrint("created directory:", relativePath)
-				if !info.IsDir() {
-					err = os.Link(currPath, goalPath)
-					vPrint("created hard link:", relativePath)
-					if err != nil {
-						panic(err)
-					}
-				}
-			}
-			return nil
-		})
-		return err
-	},
-	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 1 {
-			return errors.New("There should only be one argument")
-		}
-		fstat, err := os.Stat(args[0])
-		if os.IsNotExist(err) {
-			return errors.New("Passed path doesnt exist")
-		}
-		if !fstat.IsDir() {
-			return errors.New("Passed path isnt a directory")
+		if err := applySettings(cmd, uploadInput); err != nil {
+			return out.reportError(err)
 		}
-		return nil
+		return out.reportError(reconciliation{
+			input:           uploadInput,
+			mergeIgnores:    uploadMergeIgnores,
+			useGitignore:    uploadUseGitignore,
+			git:             uploadGit,
+			linkMode:        uploadLinkMode,
+			symlinks:        uploadSymlinks,
+			symlinksOutside: uploadSymlinksOutside,
+			dryRun:          uploadDryRun,
+			upload:          true,
+			force:           uploadForce,
+		}.run(args, out))
 	},
+	Args: destinationArgs(&uploadInput),
 }
 
 var uploadInput string
 var uploadMergeIgnores bool
+var uploadUseGitignore bool
+var uploadGit string
 var uploadForce bool
+var uploadDryRun bool
+var uploadLinkMode string
+var uploadOutput string
+var uploadSymlinks string
+var uploadSymlinksOutside bool
 
 func init() {
 	rootCmd.AddCommand(uploadCmd)
@@ -122,5 +71,12 @@ func init() {
 	// Local flags
 	uploadCmd.Flags().StringVarP(&uploadInput, "input", "i", ".", "Input directory of the files to be uploaded")
 	uploadCmd.Flags().BoolVarP(&uploadMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	uploadCmd.Flags().BoolVar(&uploadUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	uploadCmd.Flags().StringVar(&uploadGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
 	uploadCmd.Flags().BoolVar(&uploadForce, "force", false, "Forces the upload even if warnings pop up")
+	uploadCmd.Flags().StringVar(&uploadLinkMode, "link-mode", string(utils.LinkHard), "How files are put into the drive folder: hardlink, reflink, copy or auto")
+	uploadCmd.Flags().StringVar(&uploadSymlinks, "symlinks", string(utils.SymlinksPreserve), "What is done with symlinks: preserve, follow, skip or copy-target")
+	uploadCmd.Flags().BoolVar(&uploadSymlinksOutside, "symlinks-outside", false, "Allows following symlinks that point outside of the input directory")
+	uploadCmd.Flags().StringVar(&uploadOutput, "output", outputText, "Output format: text, json or ndjson")
+	uploadCmd.Flags().BoolVar(&uploadDryRun, "dry-run", false, "Prints what would be done without touching the filesystem")
 }
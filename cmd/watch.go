@@ -0,0 +1,192 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/shilangyu/driveignore/utils"
+	"github.com/spf13/cobra"
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch [drive sync folder path]",
+	Short: "Keeps the drive sync folder mirrored",
+	Long: `Unifies the input directory with the drive sync folder and keeps on watching
+the input directory. Every created, removed or renamed file is then uploaded
+or cleaned right away. Editing any .driveignore (or .gitignore with --use-gitignore)
+reloads the rules and unifies the whole directory again.
+
+Changes are collected until nothing happens for the --debounce duration.
+Stop watching with Ctrl+C.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vPrint := utils.VPrintWrapper(verbose)
+
+		if err := applySettings(cmd, watchInput); err != nil {
+			return err
+		}
+		destination, err := destinationPath(watchInput, args)
+		if err != nil {
+			return err
+		}
+
+		linkMode, err := utils.ParseLinkMode(watchLinkMode)
+		if err != nil {
+			return err
+		}
+
+		walkOptions, err := parseWalkOptions(watchSymlinks, watchSymlinksOutside)
+		if err != nil {
+			return err
+		}
+		opts := utils.PlanOptions{WalkOptions: walkOptions, LinkMode: linkMode}
+
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+
+		var driveignore *utils.Ignorer
+
+		// watchDirs adds a watch to every directory that is not ignored
+		watchDirs := func(path string) error {
+			if fstat, err := os.Stat(path); err != nil || !fstat.IsDir() {
+				return err
+			}
+			if err := watcher.Add(path); err != nil {
+				return err
+			}
+			return utils.IgnoreWalker(path, driveignore, walkOptions, nil, func(currPath string, info os.FileInfo, relativePath string) error {
+				if info.IsDir() {
+					return watcher.Add(currPath)
+				}
+				return nil
+			})
+		}
+
+		// unifyAll reloads the .driveignores and unifies the whole input
+		unifyAll := func() error {
+			driveignore, err = loadDriveIgnore(watchInput, utils.IgnoreOptions{MergeIgnores: watchMergeIgnores, UseGitignore: watchUseGitignore, Git: utils.GitMode(watchGit)}, vPrint)
+			if err != nil {
+				return err
+			}
+			if err := watchDirs(watchInput); err != nil {
+				return err
+			}
+			opts.Skipped = skippedPrinter(vPrint)
+			opts.Ignored = driveignore
+			plan, err := utils.PlanUnify(watchInput, destination, driveignore, opts)
+			if err != nil {
+				return err
+			}
+			return applyPlan(plan, false, textOutput, vPrint)
+		}
+
+		if err := unifyAll(); err != nil {
+			return err
+		}
+		vPrint("watching", watchInput)
+
+		pending := map[string]bool{}
+		var debounce <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return nil
+				}
+				relativePath, err := filepath.Rel(watchInput, event.Name)
+				if err != nil {
+					continue
+				}
+				pending[relativePath] = true
+				if event.Op&fsnotify.Create != 0 {
+					if d := driveignore.Explain(event.Name, true); d == nil || !d.Ignored {
+						// the directory might be gone already, its removal is pending anyway
+						if err := watchDirs(event.Name); err != nil && !os.IsNotExist(err) {
+							fmt.Println("watch error:", err)
+						}
+					}
+				}
+				debounce = time.After(watchDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return nil
+				}
+				fmt.Println("watch error:", err)
+			case <-debounce:
+				debounce = nil
+
+				reload := false
+				relativePaths := make([]string, 0, len(pending))
+				for relativePath := range pending {
+					relativePaths = append(relativePaths, relativePath)
+					name := filepath.Base(relativePath)
+					reload = reload || name == utils.IgnoreFileName || (watchUseGitignore && name == utils.GitIgnoreFileName)
+				}
+				pending = map[string]bool{}
+
+				if reload {
+					vPrint("ignore rules changed, unifying everything")
+					err = unifyAll()
+				} else {
+					var plan *utils.Plan
+					plan, err = utils.PlanPaths(watchInput, destination, driveignore, relativePaths, utils.PlanOptions{
+						WalkOptions: walkOptions,
+						LinkMode:    linkMode,
+					})
+					if err == nil {
+						err = applyPlan(plan, false, textOutput, vPrint)
+					}
+				}
+				// keep on watching, the next change may fix it
+				if err != nil {
+					fmt.Println(err)
+				}
+			}
+		}
+	},
+	Args: destinationArgs(&watchInput),
+}
+
+var watchInput string
+var watchMergeIgnores bool
+var watchUseGitignore bool
+var watchGit string
+var watchDebounce time.Duration
+var watchLinkMode string
+var watchSymlinks string
+var watchSymlinksOutside bool
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	// Local flags
+	watchCmd.Flags().StringVarP(&watchInput, "input", "i", ".", "Input directory of the files to be watched")
+	watchCmd.Flags().BoolVarP(&watchMergeIgnores, "merge-ignores", "M", false, "Merges global and input dir .driveignore")
+	watchCmd.Flags().BoolVar(&watchUseGitignore, "use-gitignore", false, "Also applies .gitignores and git exclude files, .driveignores take precedence")
+	watchCmd.Flags().StringVar(&watchGit, "git", "", "Only takes the files git knows about: tracked or tracked+untracked")
+	watchCmd.Flags().StringVar(&watchLinkMode, "link-mode", string(utils.LinkHard), "How files are put into the drive folder: hardlink, reflink, copy or auto")
+	watchCmd.Flags().StringVar(&watchSymlinks, "symlinks", string(utils.SymlinksPreserve), "What is done with symlinks: preserve, follow, skip or copy-target")
+	watchCmd.Flags().BoolVar(&watchSymlinksOutside, "symlinks-outside", false, "Allows following symlinks that point outside of the input directory")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 500*time.Millisecond, "How long to wait for more changes before syncing")
+}
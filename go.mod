@@ -3,7 +3,9 @@ module github.com/shilangyu/driveignore
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/fatih/color v1.18.0
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/kr/pretty v0.2.0 // indirect
 	github.com/monochromegane/go-gitignore v0.0.0-20160105113617-38717d0a108c
 	github.com/spf13/cobra v1.8.1
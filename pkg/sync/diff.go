@@ -0,0 +1,77 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"os"
+
+	"github.com/shilangyu/driveignore/utils"
+)
+
+// Category is the kind of a difference between the input and the drive sync folder
+type Category string
+
+const (
+	// Missing entries of the input are not in the drive sync folder
+	Missing Category = "missing"
+	// Extra entries of the drive sync folder do not exist in the input
+	Extra Category = "extra"
+	// Broken files lost their link but the content is the same, only found with DiffOptions.Content
+	Broken Category = "broken"
+	// Diverged files lost their link and the content differs, only found with DiffOptions.Content
+	Diverged Category = "diverged"
+)
+
+// Difference is an entry that is not in sync
+type Difference struct {
+	Category Category
+	// Path is relative to both the input and the drive sync folder
+	Path string
+	// Info is of the input entry, for extra ones of the drive sync folder entry
+	Info os.FileInfo
+}
+
+// DiffOptions configure what a diff compares
+type DiffOptions struct {
+	Options
+	// Paths (relative to the input) limit the comparison to these subtrees, all of it when empty
+	Paths []string
+	// Content compares files that are no longer linked instead of reporting them as both missing and extra
+	Content bool
+}
+
+var categories = map[utils.DiffCategory]Category{
+	utils.DiffMissing:  Missing,
+	utils.DiffExtra:    Extra,
+	utils.DiffBroken:   Broken,
+	utils.DiffDiverged: Diverged,
+}
+
+// Diff compares input with destination calling found for every difference.
+// The missing (and with Content the broken and diverged) entries come first, then the extra ones
+func Diff(input string, destination string, opts DiffOptions, found func(Difference) error) error {
+	driveignore, err := opts.ignore(input)
+	if err != nil {
+		return ownError(err)
+	}
+	walkOptions, err := opts.Walk.internal()
+	if err != nil {
+		return ownError(err)
+	}
+	diffOptions := utils.DiffOptions{WalkOptions: walkOptions, Skipped: opts.Skipped, Paths: opts.Paths, Content: opts.Content}
+	return ownError(utils.Diff(input, destination, driveignore, diffOptions, func(diff utils.Difference) error {
+		return found(Difference{categories[diff.Category], diff.Path, diff.Info})
+	}))
+}
@@ -0,0 +1,176 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sync embeds driveignore: it mirrors an input directory into a drive sync folder
+// with respect to its .driveignores the exact same way the driveignore commands do.
+// Options are plain structs, nothing is read from flags or printed out
+package sync
+
+import (
+	"errors"
+	"os"
+
+	"github.com/shilangyu/driveignore/utils"
+)
+
+// Options are shared by walks, diffs and syncs of an input directory
+type Options struct {
+	// Ignore are the applied .driveignores, when nil they are loaded from the input directory
+	Ignore *Ignorer
+	// MergeIgnores merges the global .driveignore with the local one when Ignore is loaded
+	MergeIgnores bool
+	// UseGitignore also applies the .gitignores, .git/info/exclude and core.excludesFile
+	// when Ignore is loaded, the .driveignores take precedence over them
+	UseGitignore bool
+	// Git limits the files to the ones of the git index when Ignore is loaded
+	Git GitMode
+	// Walk configures the treatment of symlinks
+	Walk WalkOptions
+	// Skipped (if not nil) is called for every entry left out because of the .driveignores
+	Skipped func(currPath string, info os.FileInfo, relativePath string)
+}
+
+// SyncOptions configure what a sync does, at least one of Upload and Clean has to be set
+type SyncOptions struct {
+	Options
+	// Upload links the input files into the drive sync folder
+	Upload bool
+	// LinkMode is how files are uploaded
+	LinkMode LinkMode
+	// Force replaces uploaded files with the same name but different content
+	Force bool
+	// Clean removes the uploaded entries that no longer exist in the input
+	Clean bool
+	// CleanIgnored also removes the uploaded entries the .driveignores ignore by now
+	CleanIgnored bool
+	// Trash (if not empty) is the trash directory removed and replaced entries are moved to instead of being deleted.
+	// Without it a directory is only replaced by a file when everything inside of it was created by driveignore
+	Trash string
+}
+
+// OpKind is what an operation does to the drive sync folder
+type OpKind string
+
+// The kinds of operations of a sync
+const (
+	OpMkdir   OpKind = "mkdir"
+	OpLink    OpKind = "link"
+	OpReplace OpKind = "replace"
+	OpRemove  OpKind = "remove"
+)
+
+// Operation is a single change of the drive sync folder
+type Operation struct {
+	Kind OpKind
+	// Path is relative to both the input and the drive sync folder
+	Path string
+	// Method is how the file was created, only set for applied operations
+	Method LinkMode
+}
+
+func ownOperation(op utils.Operation) Operation {
+	return Operation{Kind: OpKind(op.Kind), Path: op.Path, Method: LinkMode(op.Method)}
+}
+
+// Plan is the set of operations mirroring the input into the drive sync folder
+type Plan struct {
+	// Operations are in the order they are performed in, creates first and removals last
+	Operations []Operation
+	// Conflicts are files with the same name but different content that will not be replaced
+	Conflicts []string
+
+	plan *utils.Plan
+}
+
+// Apply performs the operations. done (if not nil) is called for every performed operation, never concurrently.
+// A failed operation does not stop the others, all failures are returned together as an *ApplyError
+func (p *Plan) Apply(done func(Operation)) error {
+	return ownError(p.plan.Apply(func(op utils.Operation) {
+		if done != nil {
+			done(ownOperation(op))
+		}
+	}))
+}
+
+// TrashEntry returns the id of the trash entry the removed and replaced entries were moved to, empty if none were
+func (p *Plan) TrashEntry() string {
+	if entry := p.plan.Trashed(); entry != nil {
+		return entry.ID
+	}
+	return ""
+}
+
+// NewPlan computes the operations of a sync without touching the filesystem.
+// Uploading and cleaning at once replaces conflicting files like Force does
+func NewPlan(input string, destination string, opts SyncOptions) (*Plan, error) {
+	plan, err := newPlan(input, destination, opts)
+	if err != nil {
+		return nil, ownError(err)
+	}
+	own := &Plan{Conflicts: plan.Conflicts, plan: plan}
+	for _, op := range plan.Operations {
+		own.Operations = append(own.Operations, ownOperation(op))
+	}
+	return own, nil
+}
+
+func newPlan(input string, destination string, opts SyncOptions) (*utils.Plan, error) {
+	walkOptions, err := opts.Walk.internal()
+	if err != nil {
+		return nil, err
+	}
+	planOptions := utils.PlanOptions{WalkOptions: walkOptions, LinkMode: utils.LinkHard, Force: opts.Force, Skipped: opts.Skipped}
+	if opts.LinkMode != "" {
+		if planOptions.LinkMode, err = utils.ParseLinkMode(string(opts.LinkMode)); err != nil {
+			return nil, err
+		}
+	}
+
+	var driveignore *utils.Ignorer
+	if opts.Upload || opts.CleanIgnored {
+		if driveignore, err = opts.ignore(input); err != nil {
+			return nil, err
+		}
+		if opts.CleanIgnored {
+			planOptions.Ignored = driveignore
+		}
+	}
+
+	var plan *utils.Plan
+	switch {
+	case opts.Upload && opts.Clean:
+		plan, err = utils.PlanUnify(input, destination, driveignore, planOptions)
+	case opts.Upload:
+		plan, err = utils.PlanUpload(input, destination, driveignore, planOptions)
+	case opts.Clean:
+		plan, err = utils.PlanClean(input, destination, planOptions)
+	default:
+		return nil, &ConfigError{Err: errors.New("Nothing to sync, neither Upload nor Clean is set")}
+	}
+	if err != nil {
+		return nil, err
+	}
+	plan.Trash = opts.Trash
+	return plan, nil
+}
+
+// Sync mirrors input into destination. done (if not nil) is called for every performed operation.
+// The returned plan holds the conflicts left alone and the trash entry of the removals
+func Sync(input string, destination string, opts SyncOptions, done func(Operation)) (*Plan, error) {
+	plan, err := NewPlan(input, destination, opts)
+	if err != nil {
+		return nil, err
+	}
+	return plan, plan.Apply(done)
+}
@@ -0,0 +1,80 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Sync(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_Sync_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_Sync_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	testutil.WriteFiles(t, input, map[string]string{
+		".driveignore": "*.log\n",
+		"a/file.txt":   "a",
+		"b.txt":        "b",
+		"x.log":        "ignored",
+	})
+
+	_, err = NewPlan(input, destination, SyncOptions{})
+	req.IsType(&ConfigError{}, err)
+	_, err = NewPlan(input, destination, SyncOptions{Upload: true, Options: Options{Walk: WalkOptions{Symlinks: "sometimes"}}})
+	req.IsType(&ConfigError{}, err)
+
+	driveignore, ignoreType, err := LoadIgnore(input, Options{})
+	req.NoError(err)
+	req.Equal(LocalIgnore, ignoreType)
+	d := driveignore.Explain(filepath.Join(input, "x.log"), false)
+	req.NotNil(d)
+	req.Equal(Decision{Ignored: true, Type: LocalIgnore, Source: filepath.Join(input, ".driveignore"), Line: 1, Pattern: "*.log", Path: filepath.Join(input, "x.log")}, *d)
+
+	var walked []string
+	req.NoError(Walk(input, Options{}, func(currPath string, info os.FileInfo, relativePath string) error {
+		walked = append(walked, filepath.ToSlash(relativePath))
+		return nil
+	}))
+	req.Equal([]string{".driveignore", "a/", "a/file.txt", "b.txt"}, walked)
+
+	_, err = Sync(input, destination, SyncOptions{Upload: true}, nil)
+	req.NoError(err)
+	req.FileExists(filepath.Join(destination, "a", "file.txt"))
+	req.NoFileExists(filepath.Join(destination, "x.log"))
+
+	// removed and newly ignored files are cleaned up
+	req.NoError(os.Remove(filepath.Join(input, "b.txt")))
+	testutil.WriteFiles(t, input, map[string]string{".driveignore": "*.log\na/\n"})
+
+	var diffs []string
+	req.NoError(Diff(input, destination, DiffOptions{}, func(diff Difference) error {
+		diffs = append(diffs, string(diff.Category)+" "+filepath.ToSlash(diff.Path))
+		return nil
+	}))
+	sort.Strings(diffs)
+	req.Equal([]string{"extra b.txt"}, diffs)
+
+	var ops []string
+	_, err = Sync(input, destination, SyncOptions{Upload: true, Clean: true, CleanIgnored: true}, func(op Operation) {
+		ops = append(ops, string(op.Kind)+" "+filepath.ToSlash(op.Path))
+	})
+	req.NoError(err)
+	sort.Strings(ops)
+	req.Equal([]string{"remove a/", "remove a/file.txt", "remove b.txt"}, ops)
+
+	diffs = nil
+	req.NoError(Diff(input, destination, DiffOptions{}, func(diff Difference) error {
+		diffs = append(diffs, string(diff.Category)+" "+diff.Path)
+		return nil
+	}))
+	req.Empty(diffs)
+}
@@ -0,0 +1,185 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shilangyu/driveignore/utils"
+)
+
+// IgnoreType is which .driveignores an Ignorer was loaded from, or the kind of rule that decided about a path
+type IgnoreType int
+
+// The kinds of loaded .driveignores and rules
+const (
+	NoIgnore IgnoreType = iota
+	LocalIgnore
+	GlobalIgnore
+	MergedIgnore
+	NestedIgnore
+	GitIgnore
+	GitExclude
+	GitUntracked
+)
+
+var ignoreTypes = map[utils.IgnoreType]IgnoreType{
+	utils.NoIgnore:     NoIgnore,
+	utils.LocalIgnore:  LocalIgnore,
+	utils.GlobalIgnore: GlobalIgnore,
+	utils.MergedIgnore: MergedIgnore,
+	utils.NestedIgnore: NestedIgnore,
+	utils.GitIgnore:    GitIgnore,
+	utils.GitExclude:   GitExclude,
+	utils.GitUntracked: GitUntracked,
+}
+
+// String returns the name of the ignore type as printed by driveignore
+func (t IgnoreType) String() string {
+	for internal, own := range ignoreTypes {
+		if own == t {
+			return internal.String()
+		}
+	}
+	return NoIgnore.String()
+}
+
+// SymlinkPolicy is what walks do with symbolic links
+type SymlinkPolicy string
+
+// The symlink policies, the zero value preserves symlinks
+const (
+	SymlinksPreserve   SymlinkPolicy = "preserve"
+	SymlinksFollow     SymlinkPolicy = "follow"
+	SymlinksSkip       SymlinkPolicy = "skip"
+	SymlinksCopyTarget SymlinkPolicy = "copy-target"
+)
+
+// WalkOptions configure how symlinks are treated and how many directories are read at once
+type WalkOptions struct {
+	Symlinks SymlinkPolicy
+	// SymlinksOutside allows following symlinks that point outside of the walked directory
+	SymlinksOutside bool
+	// Jobs is the amount of directories read at once, all CPUs when not positive
+	Jobs int
+	// Warn (if not nil) is called for every entry left out because of a problem with it,
+	// like a followed symlink pointing outside of the walked directory
+	Warn func(error)
+}
+
+// internal converts the options, the policy has to be a known one
+func (o WalkOptions) internal() (utils.WalkOptions, error) {
+	opts := utils.WalkOptions{SymlinksOutside: o.SymlinksOutside, Jobs: o.Jobs, Warn: o.Warn}
+	if o.Symlinks == "" {
+		return opts, nil
+	}
+	var err error
+	opts.Symlinks, err = utils.ParseSymlinkPolicy(string(o.Symlinks))
+	return opts, err
+}
+
+// LinkMode is the way files are put into the drive sync folder
+type LinkMode string
+
+// The link modes, the zero value creates hard links. LinkSymlink is only reported for recreated symlinks
+const (
+	LinkHard    LinkMode = "hardlink"
+	LinkReflink LinkMode = "reflink"
+	LinkCopy    LinkMode = "copy"
+	LinkAuto    LinkMode = "auto"
+	LinkSymlink LinkMode = "symlink"
+)
+
+// GitMode limits the files to the ones git knows about
+type GitMode string
+
+// The git modes, the zero value takes all files
+const (
+	GitAll              GitMode = ""
+	GitTracked          GitMode = "tracked"
+	GitTrackedUntracked GitMode = "tracked+untracked"
+)
+
+// ConfigError is returned for invalid options and .driveignores
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// OperationError is a single operation of a plan that failed
+type OperationError struct {
+	Operation Operation
+	Err       error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("%s '%s': %v", e.Operation.Kind, e.Operation.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyError is returned when some operations of a plan failed, the rest is performed
+type ApplyError struct {
+	Failures   []*OperationError
+	Operations int
+}
+
+func (e *ApplyError) Error() string {
+	lines := []string{e.Summary() + ":"}
+	for _, failure := range e.Failures {
+		lines = append(lines, "  "+failure.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Summary tells how many of the operations failed
+func (e *ApplyError) Summary() string {
+	return fmt.Sprintf("%d of %d operations failed", len(e.Failures), e.Operations)
+}
+
+// Partial reports whether some of the operations were applied
+func (e *ApplyError) Partial() bool {
+	return len(e.Failures) < e.Operations
+}
+
+// ownError converts the errors of the driveignore internals into the ones of this package
+func ownError(err error) error {
+	var applyErr *utils.ApplyError
+	var configErr *utils.ConfigError
+	switch {
+	case errors.As(err, &applyErr):
+		own := &ApplyError{Operations: applyErr.Operations}
+		for _, failure := range applyErr.Failures {
+			own.Failures = append(own.Failures, &OperationError{Operation: ownOperation(failure.Operation), Err: failure.Err})
+		}
+		return own
+	case errors.As(err, &configErr):
+		return &ConfigError{Err: configErr.Err}
+	}
+	return err
+}
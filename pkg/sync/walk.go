@@ -0,0 +1,113 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"errors"
+	"os"
+
+	"github.com/shilangyu/driveignore/utils"
+)
+
+// ErrNoIgnore is returned when neither the input directory nor the global config has a .driveignore
+// and git is not used
+var ErrNoIgnore = &ConfigError{Err: errors.New("No local nor global .driveignores found")}
+
+// Ignorer matches the paths left out by the .driveignores of a directory, it is created by LoadIgnore
+type Ignorer struct {
+	ignorer *utils.Ignorer
+}
+
+// Decision is the rule that decided about a path
+type Decision struct {
+	// Ignored says if the path will be skipped
+	Ignored bool
+	// Type says which kind of .driveignore the rule comes from
+	Type IgnoreType
+	// Source is the path of the file the rule comes from
+	Source string
+	// Line is the line number of the rule in Source
+	Line int
+	// Pattern is the rule as written in Source
+	Pattern string
+	// Path is the path the rule matched, either the asked one or one of its parent directories
+	Path string
+}
+
+// Match reports whether the path is ignored, its parent directories are not taken into account
+func (ig *Ignorer) Match(path string, isDir bool) bool {
+	return ig.ignorer.Match(path, isDir)
+}
+
+// Explain returns the rule deciding about the path or nil if no rule matched it.
+// A path inside of an ignored directory is ignored as well
+func (ig *Ignorer) Explain(path string, isDir bool) *Decision {
+	d := ig.ignorer.Explain(path, isDir)
+	if d == nil {
+		return nil
+	}
+	return &Decision{Ignored: d.Ignored, Type: ignoreTypes[d.Type], Source: d.Source, Line: d.Line, Pattern: d.Pattern, Path: d.Path}
+}
+
+// LoadIgnore resolves the .driveignores of input as set by MergeIgnores, UseGitignore and Git of opts:
+// the local one, the global one or both merged. The .driveignores nested in subdirectories are respected as well
+func LoadIgnore(input string, opts Options) (*Ignorer, IgnoreType, error) {
+	driveignore, driveignoreType, err := loadIgnore(input, opts)
+	if err != nil {
+		return nil, NoIgnore, ownError(err)
+	}
+	return &Ignorer{driveignore}, ignoreTypes[driveignoreType], nil
+}
+
+func loadIgnore(input string, opts Options) (*utils.Ignorer, utils.IgnoreType, error) {
+	ignoreOptions := utils.IgnoreOptions{MergeIgnores: opts.MergeIgnores, UseGitignore: opts.UseGitignore}
+	if opts.Git != GitAll {
+		var err error
+		if ignoreOptions.Git, err = utils.ParseGitMode(string(opts.Git)); err != nil {
+			return nil, utils.NoIgnore, err
+		}
+	}
+	driveignore, driveignoreType, err := utils.DriveIgnore(input, ignoreOptions)
+	if err != nil {
+		return nil, utils.NoIgnore, err
+	}
+	if driveignore == nil {
+		return nil, utils.NoIgnore, ErrNoIgnore
+	}
+	return driveignore, driveignoreType, nil
+}
+
+// ignore returns the set .driveignores or loads the ones of input
+func (o Options) ignore(input string) (*utils.Ignorer, error) {
+	if o.Ignore != nil {
+		return o.Ignore.ignorer, nil
+	}
+	driveignore, _, err := loadIgnore(input, o)
+	return driveignore, err
+}
+
+// Walk visits the entries of input that are uploaded, in lexical order.
+// walk gets the path of the entry, its info and the path relative to input
+func Walk(input string, opts Options, walk func(currPath string, info os.FileInfo, relativePath string) error) error {
+	driveignore, err := opts.ignore(input)
+	if err != nil {
+		return ownError(err)
+	}
+	walkOptions, err := opts.Walk.internal()
+	if err != nil {
+		return ownError(err)
+	}
+	return ownError(utils.IgnoreWalker(input, driveignore, walkOptions, opts.Skipped, walk))
+}
@@ -0,0 +1,97 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+)
+
+// SameContent reports whether both files have the same content byte for byte
+func SameContent(path1 string, path2 string) (bool, error) {
+	f1, err := os.Open(path1)
+	if err != nil {
+		return false, err
+	}
+	defer f1.Close()
+	f2, err := os.Open(path2)
+	if err != nil {
+		return false, err
+	}
+	defer f2.Close()
+
+	info1, err := f1.Stat()
+	if err != nil {
+		return false, err
+	}
+	info2, err := f2.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info1.Size() != info2.Size() {
+		return false, nil
+	}
+
+	buf1, buf2 := make([]byte, 64*1024), make([]byte, 64*1024)
+	for {
+		n1, err1 := io.ReadFull(f1, buf1)
+		n2, err2 := io.ReadFull(f2, buf2)
+		if !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+		if err1 == io.EOF || err1 == io.ErrUnexpectedEOF {
+			return err2 == io.EOF || err2 == io.ErrUnexpectedEOF, nil
+		} else if err1 != nil {
+			return false, err1
+		} else if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
+			return false, err2
+		}
+	}
+}
+
+// QuickSameContent tells files of different sizes apart without reading them,
+// files of the same size are compared by a hash of their content. An equal modification time
+// proves nothing, restored backups and some copy tools keep it while the bytes differ
+func QuickSameContent(path1 string, info1 os.FileInfo, path2 string, info2 os.FileInfo) (bool, error) {
+	if info1.Size() != info2.Size() {
+		return false, nil
+	}
+	hash1, err := ContentHash(path1)
+	if err != nil {
+		return false, err
+	}
+	hash2, err := ContentHash(path2)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hash1, hash2), nil
+}
+
+// ContentHash returns the sha256 sum of the file content
+func ContentHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
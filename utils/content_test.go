@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_QuickSameContent(t *testing.T) {
+	req := require.New(t)
+	dir, err := ioutil.TempDir("", "driveignore_Test_QuickSameContent")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+
+	testutil.WriteFiles(t, dir, map[string]string{"a": "same", "b": "same", "c": "diff", "d": "longer", "e": "ffff", "f": "diff"})
+	stamp := time.Now().Add(-time.Hour)
+	for _, name := range []string{"c", "d", "e", "f"} {
+		req.NoError(os.Chtimes(filepath.Join(dir, name), stamp, stamp))
+	}
+
+	tests := []struct {
+		name   string
+		p1, p2 string
+		want   bool
+	}{
+		{"equal content", "a", "b", true},
+		{"different content", "a", "c", false},
+		{"different size", "c", "d", false},
+		// equal size and modification time still need the content to match
+		{"equal stamp, different content", "c", "e", false},
+		{"equal stamp, equal content", "c", "f", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p1, p2 := filepath.Join(dir, tt.p1), filepath.Join(dir, tt.p2)
+			info1, err := os.Stat(p1)
+			require.NoError(t, err)
+			info2, err := os.Stat(p2)
+			require.NoError(t, err)
+			same, err := QuickSameContent(p1, info1, p2, info2)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, same)
+		})
+	}
+}
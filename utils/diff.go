@@ -0,0 +1,127 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DiffCategory is the kind of a difference between the input and the destination
+type DiffCategory string
+
+const (
+	// DiffMissing entries of the input are not in the destination
+	DiffMissing DiffCategory = "missing"
+	// DiffExtra entries of the destination do not exist in the input
+	DiffExtra DiffCategory = "extra"
+	// DiffBroken files lost their link but the content is the same, only found with DiffOptions.Content
+	DiffBroken DiffCategory = "broken"
+	// DiffDiverged files lost their link and the content differs, only found with DiffOptions.Content
+	DiffDiverged DiffCategory = "diverged"
+)
+
+// Difference is an entry that is not in sync
+type Difference struct {
+	Category DiffCategory
+	// Path is relative to both the input and the destination
+	Path string
+	// Info is of the input entry, for extra ones of the destination entry
+	Info os.FileInfo
+}
+
+// DiffOptions configure what a diff compares
+type DiffOptions struct {
+	WalkOptions
+	// Skipped (if not nil) is called for every entry left out because of the .driveignores
+	Skipped func(string, os.FileInfo, string)
+	// Paths (relative to the input) limit the comparison to these subtrees, all of it when empty
+	Paths []string
+	// Content compares files that are no longer linked instead of reporting them as both missing and extra
+	Content bool
+}
+
+// Diff compares input with destination calling found for every difference.
+// The missing (and with Content the broken and diverged) entries come first, then the extra ones
+func Diff(input string, destination string, driveignore *Ignorer, opts DiffOptions, found func(Difference) error) error {
+	manifest, err := LoadManifest(destination)
+	if err != nil {
+		return err
+	}
+	filter, err := NewPathFilter(opts.Paths)
+	if err != nil {
+		return err
+	}
+
+	// content compared files are reported by the input walk only
+	compared := map[string]bool{}
+
+	// search for missing files
+	err = IgnoreWalker(input, driveignore, opts.WalkOptions, opts.Skipped, func(currPath string, info os.FileInfo, relativePath string) error {
+		if ok, err := filter.Walk(relativePath, info.IsDir()); !ok {
+			return err
+		}
+		// check if file/directory exists in drive sync folder
+		goalStat, err := WalkOptions{}.Lookup(destination, relativePath)
+		if notExist(err) {
+			return found(Difference{DiffMissing, relativePath, info})
+		} else if err != nil {
+			return err
+		}
+		if info.IsDir() != goalStat.IsDir() {
+			return found(Difference{DiffMissing, relativePath, info})
+		}
+		if info.IsDir() || manifest.InSync(relativePath, info, goalStat) {
+			return nil
+		}
+		if !opts.Content || !info.Mode().IsRegular() || !goalStat.Mode().IsRegular() {
+			return found(Difference{DiffMissing, relativePath, info})
+		}
+		compared[relativePath] = true
+		same, err := QuickSameContent(currPath, info, filepath.Join(destination, relativePath), goalStat)
+		if err != nil {
+			return err
+		}
+		if same {
+			return found(Difference{DiffBroken, relativePath, info})
+		}
+		return found(Difference{DiffDiverged, relativePath, info})
+	})
+	if err != nil {
+		return err
+	}
+
+	// search for legacy files/directories
+	return Walker(destination, WalkOptions{Jobs: opts.Jobs}, func(currPath string, info os.FileInfo, relativePath string) error {
+		if relativePath == ManifestFileName || compared[relativePath] {
+			return nil
+		}
+		if ok, err := filter.Walk(relativePath, info.IsDir()); !ok {
+			return err
+		}
+		// check if file exists in input folder
+		goalStat, err := opts.Lookup(input, relativePath)
+		if notExist(err) {
+			return found(Difference{DiffExtra, relativePath, info})
+		} else if err != nil {
+			return err
+		}
+		if goalStat.IsDir() != info.IsDir() ||
+			(!info.IsDir() && !manifest.InSync(relativePath, goalStat, info)) {
+			return found(Difference{DiffExtra, relativePath, info})
+		}
+		return nil
+	})
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Diff_fileAndDirectory(t *testing.T) {
+	req := require.New(t)
+	root, err := ioutil.TempDir("", "driveignore_Test_Diff_fileAndDirectory")
+	req.NoError(err)
+	defer os.RemoveAll(root)
+	input, destination := filepath.Join(root, "input"), filepath.Join(root, "destination")
+
+	// a directory on one side is a file on the other, in both directions
+	testutil.WriteFiles(t, input, map[string]string{"a/b": "", "c": ""})
+	testutil.WriteFiles(t, destination, map[string]string{"a": "", "c/d": ""})
+
+	sep := string(filepath.Separator)
+	var differences []string
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+	err = Diff(input, destination, driveignore, DiffOptions{}, func(diff Difference) error {
+		differences = append(differences, string(diff.Category)+" "+diff.Path)
+		return nil
+	})
+	req.NoError(err)
+	req.Equal([]string{
+		"missing a" + sep,
+		"missing " + filepath.Join("a", "b"),
+		"missing c",
+		"extra a",
+		"extra c" + sep,
+		"extra " + filepath.Join("c", "d"),
+	}, differences)
+}
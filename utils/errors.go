@@ -0,0 +1,78 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConfigError is caused by invalid flags, settings or .driveignores rather than by the filesystem
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// configErrorf formats a ConfigError
+func configErrorf(format string, a ...interface{}) error {
+	return &ConfigError{fmt.Errorf(format, a...)}
+}
+
+// OperationError is a failed operation of a plan
+type OperationError struct {
+	Operation Operation
+	Err       error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("%s '%s': %v", e.Operation.Kind, e.Operation.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyError collects the operations that failed while the rest of a plan was applied
+type ApplyError struct {
+	Failures   []*OperationError
+	Operations int
+}
+
+func (e *ApplyError) Error() string {
+	lines := []string{e.Summary() + ":"}
+	for _, failure := range e.Failures {
+		lines = append(lines, "  "+failure.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Summary is the amount of failed operations
+func (e *ApplyError) Summary() string {
+	return fmt.Sprintf("%d of %d operations failed", len(e.Failures), e.Operations)
+}
+
+// Partial reports whether some of the operations were applied
+func (e *ApplyError) Partial() bool {
+	return len(e.Failures) < e.Operations
+}
@@ -0,0 +1,273 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// GitIgnoreFileName is the name of the files holding the git ignore rules
+const GitIgnoreFileName = ".gitignore"
+
+// gitLayer are the git ignore rules which apply below the .driveignores: any .driveignore
+// rule matching a path has the final say. Among themselves they take precedence like in git:
+// deeper .gitignores over the ones above, over .git/info/exclude, over core.excludesFile
+type gitLayer struct {
+	// root is the absolute path of the ignorer root, git rules are matched against absolute paths
+	root string
+	// excludes are the rules of core.excludesFile and .git/info/exclude
+	excludes rules
+	// parents are the rules of the .gitignores between the repository root and the ignorer root
+	parents rules
+	// nested are loaded while walks (possibly by many workers at once) match paths, guarded by mu
+	nested map[string]rules
+	mu     sync.Mutex
+}
+
+// newGitLayer loads the git ignore rules of the repository root is part of.
+// Outside of a repository only the .gitignores of root and core.excludesFile apply
+func newGitLayer(root string) (*gitLayer, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	g := &gitLayer{root: root, nested: map[string]rules{}}
+
+	repository, gitDir := findGitDir(root)
+	base := root
+	if gitDir != "" {
+		base = repository
+	}
+
+	if gitDir != "" {
+		gitDir = commonDir(gitDir)
+	}
+	excludesFile, err := gitExcludesFile(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{excludesFile}
+	if gitDir != "" {
+		files = append(files, filepath.Join(gitDir, "info", "exclude"))
+	}
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		content, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		// like git, invalid patterns of git files are left out
+		rs, _ := parseRules(string(content), file, base)
+		g.excludes = append(g.excludes, rs...)
+	}
+
+	if gitDir != "" && root != repository {
+		// shallower .gitignores come first so that the deeper ones take precedence
+		var dirs []string
+		for dir := filepath.Dir(root); ; dir = filepath.Dir(dir) {
+			dirs = append([]string{dir}, dirs...)
+			if dir == repository {
+				break
+			}
+		}
+		for _, dir := range dirs {
+			rs, _ := loadRules(dir, GitIgnoreFileName)
+			g.parents = append(g.parents, rs...)
+		}
+	}
+	return g, nil
+}
+
+// decide finds the git rule deciding about the path relative to the ignorer root
+func (g *gitLayer) decide(relativePath string, isDir bool) *Decision {
+	path := filepath.Join(g.root, relativePath)
+	// like in git, repository directories (and the files linking worktrees and submodules) cannot be taken
+	if filepath.Base(relativePath) == ".git" {
+		return &Decision{Ignored: true, Type: GitExclude, Path: path}
+	}
+	for dir := filepath.Dir(relativePath); ; dir = filepath.Dir(dir) {
+		if r := g.nestedRules(dir).match(path, isDir); r != nil {
+			return r.decision(GitIgnore, path)
+		}
+		if dir == "." {
+			break
+		}
+	}
+	if r := g.parents.match(path, isDir); r != nil {
+		return r.decision(GitIgnore, path)
+	}
+	if r := g.excludes.match(path, isDir); r != nil {
+		return r.decision(GitExclude, path)
+	}
+	return nil
+}
+
+// ignored reports whether git ignores the path relative to the root, also because of its parent directories
+func (g *gitLayer) ignored(relativePath string, isDir bool) bool {
+	for dir := filepath.Dir(relativePath); dir != "."; dir = filepath.Dir(dir) {
+		if d := g.decide(dir, true); d != nil && d.Ignored {
+			return true
+		}
+	}
+	d := g.decide(relativePath, isDir)
+	return d != nil && d.Ignored
+}
+
+// nestedRules lazily loads the .gitignore of a directory relative to the root
+func (g *gitLayer) nestedRules(relativeDir string) rules {
+	g.mu.Lock()
+	rs, ok := g.nested[relativeDir]
+	g.mu.Unlock()
+	if ok {
+		return rs
+	}
+	rs, _ = loadRules(filepath.Join(g.root, relativeDir), GitIgnoreFileName)
+	g.mu.Lock()
+	g.nested[relativeDir] = rs
+	g.mu.Unlock()
+	return rs
+}
+
+// loadRules reads the ignore file name of dir, a missing one has no rules.
+// The valid rules are returned even along with the error about an invalid pattern,
+// like git the git ignore files just leave such patterns out
+func loadRules(dir string, name string) (rules, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, nil
+	}
+	return parseRules(string(content), filepath.Join(dir, name), dir)
+}
+
+// findGitDir looks for the repository path is part of. It returns the root of the
+// working tree and its git directory, empty strings outside of a repository
+func findGitDir(path string) (repository string, gitDir string) {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		dotGit := filepath.Join(dir, ".git")
+		info, err := os.Stat(dotGit)
+		if err == nil && info.IsDir() {
+			return dir, dotGit
+		}
+		if err == nil {
+			// worktrees and submodules have a file pointing to their git directory
+			content, err := ioutil.ReadFile(dotGit)
+			if err == nil && strings.HasPrefix(string(content), "gitdir:") {
+				gitDir := strings.TrimSpace(strings.TrimPrefix(string(content), "gitdir:"))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+				return dir, gitDir
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return "", ""
+		}
+	}
+}
+
+// commonDir returns the git directory shared by all worktrees of gitDir,
+// it holds the config and info/exclude while the index belongs to the worktree
+func commonDir(gitDir string) string {
+	content, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	common := strings.TrimSpace(string(content))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(gitDir, common)
+	}
+	return common
+}
+
+// gitExcludesFile returns the path of core.excludesFile as set by the user and repository
+// configs, by default it is git/ignore in the XDG config directory
+func gitExcludesFile(gitDir string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	excludesFile := filepath.Join(xdg, "git", "ignore")
+	configs := []string{filepath.Join(xdg, "git", "config"), filepath.Join(home, ".gitconfig")}
+	if gitDir != "" {
+		configs = append(configs, filepath.Join(gitDir, "config"))
+	}
+	// later configs override the earlier ones
+	for _, config := range configs {
+		if value, ok := gitConfigValue(config, "core", "excludesfile"); ok {
+			excludesFile = value
+		}
+	}
+
+	if strings.HasPrefix(excludesFile, "~/") {
+		excludesFile = filepath.Join(home, excludesFile[2:])
+	}
+	return excludesFile, nil
+}
+
+// gitConfigValue reads the last value of key in section of a git config file.
+// Section and key names are case insensitive, includes are not followed
+func gitConfigValue(path string, section string, key string) (value string, ok bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	current := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				continue
+			}
+			current = strings.ToLower(strings.TrimSpace(line[1:end]))
+			line = strings.TrimSpace(line[end+1:])
+		}
+		if current != section || line == "" {
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 || !strings.EqualFold(strings.TrimSpace(line[:eq]), key) {
+			continue
+		}
+		value = strings.TrimSpace(line[eq+1:])
+		if strings.HasPrefix(value, `"`) {
+			if end := strings.Index(value[1:], `"`); end >= 0 {
+				value = value[1 : end+1]
+			}
+		} else if comment := strings.IndexAny(value, "#;"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+		ok = true
+	}
+	return value, ok
+}
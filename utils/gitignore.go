@@ -15,11 +15,12 @@
 package utils
 
 import (
+	"bufio"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
-	"runtime"
+	"strings"
+	"sync"
 
 	gitignore "github.com/monochromegane/go-gitignore"
 )
@@ -36,38 +37,313 @@ const (
 	GlobalIgnore
 	// MergedIgnore says the local and global .driveignore has been taken
 	MergedIgnore
+	// NestedIgnore says a .driveignore from a subdirectory has been taken
+	NestedIgnore
+	// GitIgnore says a .gitignore has been taken
+	GitIgnore
+	// GitExclude says .git/info/exclude or core.excludesFile has been taken
+	GitExclude
+	// GitUntracked says the path was left out because it is not in the git index
+	GitUntracked
 )
 
+// String returns the name of the ignore type as used in prints
+func (t IgnoreType) String() string {
+	switch t {
+	case LocalIgnore:
+		return "local"
+	case GlobalIgnore:
+		return "global"
+	case MergedIgnore:
+		return "merged"
+	case NestedIgnore:
+		return "nested"
+	case GitIgnore:
+		return "gitignore"
+	case GitExclude:
+		return "git exclude"
+	case GitUntracked:
+		return "untracked"
+	}
+	return "none"
+}
+
+// IgnoreFileName is the name of the files holding the ignore rules
+const IgnoreFileName = ".driveignore"
+
+// rule is a single pattern line of a .driveignore
+type rule struct {
+	source  string
+	line    int
+	pattern string
+	negate  bool
+	matcher gitignore.IgnoreMatcher
+}
+
+// rules are all patterns of a .driveignore, later ones take precedence
+type rules []rule
+
+// parseRules parses the content of the source .driveignore which patterns are relative to base.
+// Invalid patterns are left out and reported by the error
+func parseRules(content string, source string, base string) (rs rules, err error) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		// like in .gitignore only trailing spaces are dropped, unless they are escaped
+		line := strings.TrimRight(scanner.Text(), " ")
+		if strings.HasSuffix(line, "\\") && len(line) < len(scanner.Text()) {
+			line += " "
+		}
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		negate := strings.HasPrefix(line, "!")
+		pattern := escapePattern(strings.TrimPrefix(line, "!"))
+		if _, matchErr := filepath.Match(strings.Trim(pattern, "/"), ""); matchErr != nil {
+			if err == nil {
+				err = configErrorf("Invalid pattern '%s' in %s:%d", line, source, lineNumber)
+			}
+			continue
+		}
+		rs = append(rs, rule{
+			source:  source,
+			line:    lineNumber,
+			pattern: line,
+			negate:  negate,
+			matcher: gitignore.NewGitIgnoreFromReader(base, strings.NewReader(pattern)),
+		})
+	}
+	return
+}
+
+// escapePattern rewrites the parts of a pattern the gitignore matcher would strip or misread
+// (leading spaces, an escaped leading '#' or '!' and an escaped trailing space) as character classes
+func escapePattern(pattern string) string {
+	if strings.HasPrefix(pattern, "\\#") || strings.HasPrefix(pattern, "\\!") {
+		pattern = "[" + pattern[1:2] + "]" + pattern[2:]
+	}
+	if strings.HasSuffix(pattern, "\\ ") {
+		pattern = strings.TrimSuffix(pattern, "\\ ") + "[ ]"
+	}
+	trimmed := strings.TrimLeft(pattern, " ")
+	return strings.Repeat("[ ]", len(pattern)-len(trimmed)) + trimmed
+}
+
+// match returns the rule deciding about the path or nil if none of them matched
+func (rs rules) match(path string, isDir bool) *rule {
+	for i := len(rs) - 1; i >= 0; i-- {
+		if rs[i].matcher.Match(path, isDir) {
+			return &rs[i]
+		}
+	}
+	return nil
+}
+
+// Decision describes the rule that decided whether a path is ignored
+type Decision struct {
+	// Ignored says if the path will be skipped
+	Ignored bool
+	// Type says which kind of .driveignore the rule comes from
+	Type IgnoreType
+	// Source is the path of the .driveignore the rule comes from
+	Source string
+	// Line is the line number of the rule in Source
+	Line int
+	// Pattern is the rule as written in Source
+	Pattern string
+	// Path is the path the rule matched, either the asked one or one of its parent directories
+	Path string
+}
+
+// Ignorer matches paths against the root rules and the nested .driveignores
+// found in subdirectories. A nested .driveignore is relative to its own directory
+// and overrides the rules of its parents, the same way nested .gitignores do
+type Ignorer struct {
+	root     string
+	baseType IgnoreType
+	base     rules
+	// nested are loaded while walks (possibly by many workers at once) match paths, guarded by mu
+	nested map[string]rules
+	// err is the error of the first invalid nested .driveignore, guarded by mu
+	err error
+	mu  sync.Mutex
+	// git (if not nil) are the git ignore rules layered below the .driveignores
+	git *gitLayer
+	// source (if not nil) leaves out everything that is not taken by the git mode
+	source *gitSource
+}
+
+// Match implements gitignore.IgnoreMatcher
+func (ig *Ignorer) Match(path string, isDir bool) bool {
+	d := ig.decide(path, isDir)
+	return d != nil && d.Ignored
+}
+
+// Explain returns the rule deciding about the path or nil if no rule matched it.
+// Unlike Match it also takes the parent directories into account: a path inside
+// of an ignored directory is ignored as well because walks never enter it
+func (ig *Ignorer) Explain(path string, isDir bool) *Decision {
+	relativePath, err := filepath.Rel(ig.root, path)
+	if err != nil {
+		return nil
+	}
+
+	parents := strings.Split(filepath.Dir(relativePath), string(filepath.Separator))
+	for i := range parents {
+		parent := filepath.Join(ig.root, filepath.Join(parents[:i+1]...))
+		if d := ig.decide(parent, true); d != nil && d.Ignored {
+			return d
+		}
+	}
+	return ig.decide(path, isDir)
+}
+
+// decide finds the rule deciding about the path itself.
+// The git mode comes last: ignore rules can leave out more paths but never add any
+func (ig *Ignorer) decide(path string, isDir bool) *Decision {
+	relativePath, err := filepath.Rel(ig.root, path)
+	if err != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") {
+		return nil
+	}
+
+	d := ig.decideRules(path, relativePath, isDir)
+	if ig.source != nil && (d == nil || !d.Ignored) {
+		if untracked := ig.source.decide(relativePath, isDir, path); untracked != nil {
+			return untracked
+		}
+	}
+	return d
+}
+
+// decideRules finds the ignore rule deciding about the path
+func (ig *Ignorer) decideRules(path string, relativePath string, isDir bool) *Decision {
+	// deepest .driveignore has the final say
+	for dir := filepath.Dir(relativePath); dir != "."; dir = filepath.Dir(dir) {
+		if r := ig.nestedRules(dir).match(path, isDir); r != nil {
+			return r.decision(NestedIgnore, path)
+		}
+	}
+	if r := ig.base.match(path, isDir); r != nil {
+		return r.decision(ig.baseType, path)
+	}
+	if ig.git != nil {
+		return ig.git.decide(relativePath, isDir)
+	}
+	return nil
+}
+
+func (r *rule) decision(t IgnoreType, path string) *Decision {
+	return &Decision{
+		Ignored: !r.negate,
+		Type:    t,
+		Source:  r.source,
+		Line:    r.line,
+		Pattern: r.pattern,
+		Path:    path,
+	}
+}
+
+// nestedRules lazily loads the .driveignore of a directory relative to the root
+func (ig *Ignorer) nestedRules(relativeDir string) rules {
+	ig.mu.Lock()
+	rs, ok := ig.nested[relativeDir]
+	ig.mu.Unlock()
+	if ok {
+		return rs
+	}
+
+	rs, err := loadRules(filepath.Join(ig.root, relativeDir), IgnoreFileName)
+	ig.mu.Lock()
+	ig.nested[relativeDir] = rs
+	if ig.err == nil {
+		ig.err = err
+	}
+	ig.mu.Unlock()
+	return rs
+}
+
+// Err returns the error of the first invalid nested .driveignore loaded so far.
+// Nested .driveignores are only read once paths inside of them are matched, so walks check it when they are done
+func (ig *Ignorer) Err() error {
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+	return ig.err
+}
+
+// IgnoreOptions configure which rules an Ignorer is made of
+type IgnoreOptions struct {
+	// MergeIgnores merges the global and local .driveignore instead of taking one of them
+	MergeIgnores bool
+	// UseGitignore also applies the .gitignores, .git/info/exclude and core.excludesFile
+	UseGitignore bool
+	// Git leaves out the files that are not taken by the git mode
+	Git GitMode
+}
+
 // DriveIgnore returns a gitignore matcher with merge or not merged .driveignores
-func DriveIgnore(localPath string, mergeIgnores bool) (driveignore gitignore.IgnoreMatcher, ignorer IgnoreType) {
-	localDI := filepath.Join(localPath, ".driveignore")
-	_, currFile, _, _ := runtime.Caller(0)
-	globalDI := filepath.Join(currFile, "../../.global_driveignore")
+// which additionally respects .driveignores nested in the subdirectories of localPath.
+// Without any .driveignore the type is NoIgnore and the matcher nil, unless git is used
+func DriveIgnore(localPath string, opts IgnoreOptions) (driveignore *Ignorer, ignorer IgnoreType, err error) {
+	if _, err := ParseGitMode(string(opts.Git)); err != nil {
+		return nil, NoIgnore, err
+	}
+	mergeIgnores := opts.MergeIgnores
+
+	localDI := filepath.Join(localPath, IgnoreFileName)
+	globalDI, err := globalDriveignoreFile()
+	if err != nil {
+		return nil, NoIgnore, err
+	}
 
-	_, err1 := os.Stat(localDI)
-	_, err2 := os.Stat(globalDI)
+	localContent, err1 := ioutil.ReadFile(localDI)
+	globalContent, err2 := ioutil.ReadFile(globalDI)
+	for _, err := range []error{err1, err2} {
+		if err != nil && !os.IsNotExist(err) {
+			return nil, NoIgnore, err
+		}
+	}
+
+	var base rules
 	if os.IsNotExist(err1) && os.IsNotExist(err2) {
+		if !opts.UseGitignore && opts.Git == GitAll {
+			return nil, NoIgnore, nil
+		}
 		ignorer = NoIgnore
 	} else if (!os.IsNotExist(err1) && !mergeIgnores) || (os.IsNotExist(err2) && mergeIgnores) {
-		driveignore, _ = gitignore.NewGitIgnore(localDI, localPath)
+		base, err = parseRules(string(localContent), localDI, localPath)
 		ignorer = LocalIgnore
 	} else if (!os.IsNotExist(err2) && !mergeIgnores) || (os.IsNotExist(err1) && mergeIgnores) {
-		driveignore, _ = gitignore.NewGitIgnore(globalDI, localPath)
+		base, err = parseRules(string(globalContent), globalDI, localPath)
 		ignorer = GlobalIgnore
-	} else if !os.IsNotExist(err1) && !os.IsNotExist(err2) && mergeIgnores {
-		globalContent, _ := ioutil.ReadFile(globalDI)
-		localContent, _ := ioutil.ReadFile(localDI)
-
-		file, err := ioutil.TempFile(localPath, "tmp.*.temp")
-		if err != nil {
-			log.Fatal(err)
+	} else {
+		// local rules come last so they can override the global ones
+		global, globalErr := parseRules(string(globalContent), globalDI, localPath)
+		base, err = parseRules(string(localContent), localDI, localPath)
+		base = append(global, base...)
+		if globalErr != nil {
+			err = globalErr
 		}
-		defer os.Remove(file.Name())
-		file.Write([]byte(string(globalContent) + "\n" + string(localContent)))
-
-		driveignore, _ = gitignore.NewGitIgnore(file.Name(), localPath)
-		file.Close()
 		ignorer = MergedIgnore
 	}
+	if err != nil {
+		return nil, NoIgnore, err
+	}
+
+	driveignore = &Ignorer{
+		root:     localPath,
+		baseType: ignorer,
+		base:     base,
+		nested:   map[string]rules{},
+	}
+	if opts.UseGitignore {
+		if driveignore.git, err = newGitLayer(localPath); err != nil {
+			return nil, NoIgnore, err
+		}
+	}
+	if opts.Git != GitAll {
+		if driveignore.source, err = newGitSource(localPath, opts.Git); err != nil {
+			return nil, NoIgnore, err
+		}
+	}
 	return
 }
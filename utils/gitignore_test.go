@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// testRules parses rules that are known to be valid
+func testRules(t *testing.T, content string, base string) rules {
+	rs, err := parseRules(content, "", base)
+	require.NoError(t, err)
+	return rs
+}
+
+func Test_DriveIgnore_nested(t *testing.T) {
+	req := require.New(t)
+	root, err := ioutil.TempDir("", "driveignore_Test_DriveIgnore_nested")
+	req.NoError(err)
+	defer os.RemoveAll(root)
+	config, err := ioutil.TempDir("", "driveignore_Test_DriveIgnore_nested_config")
+	req.NoError(err)
+	defer os.RemoveAll(config)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", config)
+
+	testutil.WriteFiles(t, root, map[string]string{
+		".driveignore":     "*.log\nbuild/\n",
+		"a/.driveignore":   "!keep.log\n*.tmp\n",
+		"a/b/.driveignore": "*.txt\n",
+		"c/.driveignore":   "/only-here\n",
+		"c/d/only-here":    "",
+	})
+
+	driveignore, ignorer, err := DriveIgnore(root, IgnoreOptions{})
+	req.NoError(err)
+	req.Equal(LocalIgnore, ignorer)
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"x.log", false, true},
+		{"build", true, true},
+		{"x.txt", false, false},
+		{"a/x.log", false, true},
+		{"a/keep.log", false, false},
+		{"a/x.tmp", false, true},
+		{"x.tmp", false, false},
+		{"a/b/x.txt", false, true},
+		{"a/b/keep.log", false, false},
+		{"a/b/x.tmp", false, true},
+		{"a/x.txt", false, false},
+		{"c/only-here", false, true},
+		{"c/d/only-here", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := driveignore.Match(filepath.Join(root, tt.path), tt.isDir)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_Ignorer_Explain(t *testing.T) {
+	req := require.New(t)
+	root, err := ioutil.TempDir("", "driveignore_Test_Ignorer_Explain")
+	req.NoError(err)
+	defer os.RemoveAll(root)
+	config, err := ioutil.TempDir("", "driveignore_Test_Ignorer_Explain_config")
+	req.NoError(err)
+	defer os.RemoveAll(config)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", config)
+
+	testutil.WriteFiles(t, root, map[string]string{
+		".driveignore":   "# comment\n*.log\nbuild/\n",
+		"a/.driveignore": "!keep.log\n",
+	})
+	testutil.WriteFiles(t, filepath.Join(config, "driveignore"), map[string]string{
+		".global_driveignore": "*.tmp\n",
+	})
+
+	driveignore, ignorer, err := DriveIgnore(root, IgnoreOptions{MergeIgnores: true})
+	req.NoError(err)
+	req.Equal(MergedIgnore, ignorer)
+
+	d := driveignore.Explain(filepath.Join(root, "x.log"), false)
+	req.Equal(&Decision{true, MergedIgnore, filepath.Join(root, ".driveignore"), 2, "*.log", filepath.Join(root, "x.log")}, d)
+
+	d = driveignore.Explain(filepath.Join(root, "x.tmp"), false)
+	req.Equal(&Decision{true, MergedIgnore, filepath.Join(config, "driveignore/.global_driveignore"), 1, "*.tmp", filepath.Join(root, "x.tmp")}, d)
+
+	d = driveignore.Explain(filepath.Join(root, "a/keep.log"), false)
+	req.Equal(&Decision{false, NestedIgnore, filepath.Join(root, "a/.driveignore"), 1, "!keep.log", filepath.Join(root, "a/keep.log")}, d)
+
+	d = driveignore.Explain(filepath.Join(root, "build/sub/main.o"), false)
+	req.Equal(&Decision{true, MergedIgnore, filepath.Join(root, ".driveignore"), 3, "build/", filepath.Join(root, "build")}, d)
+
+	req.Nil(driveignore.Explain(filepath.Join(root, "main.go"), false))
+}
+
+func Test_parseRules_escapes(t *testing.T) {
+	rs := testRules(t, "#comment\n\\#hash\n\\!bang\n trailing.log   \nspace\\ \n!\\#keep\n", "/root")
+	require.Len(t, rs, 5)
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"#comment", false},
+		{"#hash", true},
+		{"hash", false},
+		{"!bang", true},
+		{"bang", false},
+		{" trailing.log", true},
+		{"trailing.log", false},
+		{"space ", true},
+		{"space", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := rs.match(filepath.Join("/root", tt.path), false)
+			require.Equal(t, tt.want, r != nil && !r.negate)
+		})
+	}
+	require.True(t, rs[4].negate)
+	require.Equal(t, "!\\#keep", rs[4].pattern)
+}
+
+func Test_DriveIgnore_legacyGlobal(t *testing.T) {
+	req := require.New(t)
+	root, err := ioutil.TempDir("", "driveignore_Test_DriveIgnore_legacyGlobal")
+	req.NoError(err)
+	defer os.RemoveAll(root)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "config"))
+	defer func(legacy string) { legacyGlobalDriveignorePath = legacy }(legacyGlobalDriveignorePath)
+	legacyGlobalDriveignorePath = filepath.Join(root, "sources", ".global_driveignore")
+
+	testutil.WriteFiles(t, root, map[string]string{"sources/.global_driveignore": "*.log\n", "drive/x.log": ""})
+	driveignore, ignorer, err := DriveIgnore(filepath.Join(root, "drive"), IgnoreOptions{})
+	req.NoError(err)
+	req.Equal(GlobalIgnore, ignorer)
+	req.True(driveignore.Match(filepath.Join(root, "drive", "x.log"), false))
+
+	// once there is one in the user config directory the legacy one is not read anymore
+	testutil.WriteFiles(t, root, map[string]string{"config/driveignore/.global_driveignore": "*.tmp\n"})
+	driveignore, _, err = DriveIgnore(filepath.Join(root, "drive"), IgnoreOptions{})
+	req.NoError(err)
+	req.False(driveignore.Match(filepath.Join(root, "drive", "x.log"), false))
+	req.True(driveignore.Match(filepath.Join(root, "drive", "x.tmp"), false))
+}
+
+func Test_Ignorer_concurrent(t *testing.T) {
+	req := require.New(t)
+	root, err := ioutil.TempDir("", "driveignore_Test_Ignorer_concurrent")
+	req.NoError(err)
+	defer os.RemoveAll(root)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", root)
+
+	testutil.WriteFiles(t, root, map[string]string{".driveignore": "*.log\n", ".gitignore": "*.tmp\n"})
+	for _, dir := range []string{"a", "b", "c", "d"} {
+		testutil.WriteFiles(t, root, map[string]string{filepath.Join(dir, ".driveignore"): "!keep.log\n", filepath.Join(dir, ".gitignore"): "*.o\n"})
+	}
+	driveignore, _, err := DriveIgnore(root, IgnoreOptions{UseGitignore: true})
+	req.NoError(err)
+
+	// nested rules are loaded by whichever worker of a walk matches a path first
+	var wg sync.WaitGroup
+	results := make([]bool, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dir := []string{"a", "b", "c", "d"}[i%4]
+			results[i] = driveignore.Match(filepath.Join(root, dir, "x.o"), false) &&
+				!driveignore.Match(filepath.Join(root, dir, "keep.log"), false)
+		}(i)
+	}
+	wg.Wait()
+	for i, ok := range results {
+		req.True(ok, i)
+	}
+}
+
+func Test_DriveIgnore_invalid(t *testing.T) {
+	req := require.New(t)
+	root, err := ioutil.TempDir("", "driveignore_Test_DriveIgnore_invalid")
+	req.NoError(err)
+	defer os.RemoveAll(root)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", root)
+
+	testutil.WriteFiles(t, root, map[string]string{".driveignore": "*.log\n[unclosed\n"})
+	_, _, err = DriveIgnore(root, IgnoreOptions{})
+	req.EqualError(err, "Invalid pattern '[unclosed' in "+filepath.Join(root, ".driveignore")+":2")
+	_, ok := err.(*ConfigError)
+	req.True(ok)
+
+	// nested .driveignores are read during walks, which report them once they are done
+	testutil.WriteFiles(t, root, map[string]string{".driveignore": "*.log\n", "a/.driveignore": "[unclosed\n*.tmp\n", "a/x.tmp": ""})
+	driveignore, _, err := DriveIgnore(root, IgnoreOptions{})
+	req.NoError(err)
+	req.NoError(driveignore.Err())
+	var walked []string
+	err = IgnoreWalker(root, driveignore, WalkOptions{}, nil, func(currPath string, info os.FileInfo, relativePath string) error {
+		walked = append(walked, relativePath)
+		return nil
+	})
+	req.EqualError(err, "Invalid pattern '[unclosed' in "+filepath.Join(root, "a", ".driveignore")+":1")
+	_, ok = err.(*ConfigError)
+	req.True(ok)
+	// the valid rules still apply
+	req.NotContains(walked, filepath.Join("a", "x.tmp"))
+}
+
+func Test_DriveIgnore_gitignore(t *testing.T) {
+	req := require.New(t)
+	repository, err := ioutil.TempDir("", "driveignore_Test_DriveIgnore_gitignore")
+	req.NoError(err)
+	defer os.RemoveAll(repository)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(repository, "config"))
+
+	excludesFile := filepath.Join(repository, "excludes")
+	testutil.WriteFiles(t, repository, map[string]string{
+		".git/config":            "[core]\n\tbare = false\n[Core]\n\texcludesFile = \"" + excludesFile + "\"\n",
+		".git/info/exclude":      "*.exclude\n",
+		"excludes":               "*.user\n*.bak\n",
+		".gitignore":             "*.log\n",
+		"input/.gitignore":       "*.tmp\n",
+		"input/a/.gitignore":     "!keep.tmp\n*.user\n",
+		"input/.driveignore":     "!important.log\n*.secret\n",
+		"input/a/b/.driveignore": "!x.bak\n",
+	})
+	root := filepath.Join(repository, "input")
+
+	driveignore, _, err := DriveIgnore(root, IgnoreOptions{})
+	req.NoError(err)
+	req.False(driveignore.Match(filepath.Join(root, "x.log"), false))
+
+	driveignore, ignorer, err := DriveIgnore(root, IgnoreOptions{UseGitignore: true})
+	req.NoError(err)
+	req.Equal(LocalIgnore, ignorer)
+
+	tests := []struct {
+		path    string
+		want    IgnoreType
+		ignored bool
+	}{
+		{"x.secret", LocalIgnore, true},
+		{"x.log", GitIgnore, true},
+		{"important.log", LocalIgnore, false},
+		{"x.tmp", GitIgnore, true},
+		{"a/keep.tmp", GitIgnore, false},
+		{"x.exclude", GitExclude, true},
+		{"x.user", GitExclude, true},
+		{"a/x.user", GitIgnore, true},
+		{"x.bak", GitExclude, true},
+		{"a/b/x.bak", NestedIgnore, false},
+		{"x.go", NoIgnore, false},
+		{".git", GitExclude, true},
+		{"a/.git", GitExclude, true},
+	}
+	for _, tt := range tests {
+		d := driveignore.Explain(filepath.Join(root, tt.path), false)
+		if tt.want == NoIgnore {
+			req.Nil(d, tt.path)
+			continue
+		}
+		req.NotNil(d, tt.path)
+		req.Equal(tt.want, d.Type, tt.path)
+		req.Equal(tt.ignored, d.Ignored, tt.path)
+	}
+
+	// no rule brings back what is inside of a repository directory
+	testutil.WriteFiles(t, root, map[string]string{"a/.gitignore": "!.git\n!HEAD\n"})
+	driveignore, _, err = DriveIgnore(root, IgnoreOptions{UseGitignore: true})
+	req.NoError(err)
+	req.True(driveignore.Match(filepath.Join(root, "a", ".git"), true))
+	d := driveignore.Explain(filepath.Join(root, "a", ".git", "HEAD"), false)
+	req.NotNil(d)
+	req.True(d.Ignored)
+
+	// without any .driveignore only the git rules apply
+	req.NoError(os.Remove(filepath.Join(root, ".driveignore")))
+	driveignore, ignorer, err = DriveIgnore(root, IgnoreOptions{UseGitignore: true})
+	req.NoError(err)
+	req.Equal(NoIgnore, ignorer)
+	req.True(driveignore.Match(filepath.Join(root, "important.log"), false))
+}
@@ -0,0 +1,239 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// GitMode limits the uploaded files to the ones git knows about
+type GitMode string
+
+const (
+	// GitAll does not look at git, every file is a candidate
+	GitAll GitMode = ""
+	// GitTracked only takes the files of the git index
+	GitTracked GitMode = "tracked"
+	// GitTrackedUntracked also takes the untracked files that git does not ignore
+	GitTrackedUntracked GitMode = "tracked+untracked"
+)
+
+// ParseGitMode validates the name of a git mode, an empty one takes all files
+func ParseGitMode(mode string) (GitMode, error) {
+	switch GitMode(mode) {
+	case GitAll, GitTracked, GitTrackedUntracked:
+		return GitMode(mode), nil
+	}
+	return "", configErrorf("Invalid git mode '%s', should be one of: tracked, tracked+untracked", mode)
+}
+
+// gitSource decides which paths are candidates for an upload with respect to a git mode
+type gitSource struct {
+	// index is the path of the read index file
+	index string
+	// files are the tracked files relative to the ignorer root, slash separated
+	files map[string]bool
+	// dirs are the directories holding tracked files
+	dirs map[string]bool
+	// trees are submodules, their whole content is taken
+	trees map[string]bool
+	// untracked (if not nil) lets in the untracked files that git does not ignore
+	untracked *gitLayer
+}
+
+// newGitSource reads the index of the repository root is part of
+func newGitSource(root string, mode GitMode) (*gitSource, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	repository, gitDir := findGitDir(root)
+	if gitDir == "" {
+		return nil, configErrorf("Input directory '%s' isnt part of a git repository", root)
+	}
+	prefix, err := filepath.Rel(repository, root)
+	if err != nil {
+		return nil, err
+	}
+	prefix = filepath.ToSlash(prefix)
+
+	hashSize := 20
+	if format, ok := gitConfigValue(filepath.Join(commonDir(gitDir), "config"), "extensions", "objectformat"); ok && strings.EqualFold(format, "sha256") {
+		hashSize = 32
+	}
+	s := &gitSource{
+		index: filepath.Join(gitDir, "index"),
+		files: map[string]bool{},
+		dirs:  map[string]bool{},
+		trees: map[string]bool{},
+	}
+	entries, err := readGitIndex(s.index, hashSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.name
+		if prefix != "." {
+			if !strings.HasPrefix(name, prefix+"/") {
+				continue
+			}
+			name = name[len(prefix)+1:]
+		}
+		switch {
+		// gitlinks are submodules, directories of sparse indexes are not expanded
+		case entry.mode&0170000 == 0160000 || entry.mode&0170000 == 0040000:
+			s.trees[strings.TrimSuffix(name, "/")] = true
+		default:
+			s.files[name] = true
+		}
+		for dir := path.Dir(strings.TrimSuffix(name, "/")); dir != "."; dir = path.Dir(dir) {
+			s.dirs[dir] = true
+		}
+	}
+
+	if mode == GitTrackedUntracked {
+		if s.untracked, err = newGitLayer(root); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// candidate reports whether the path relative to the root can be uploaded
+func (s *gitSource) candidate(relativePath string, isDir bool) bool {
+	name := filepath.ToSlash(relativePath)
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		if s.trees[dir] {
+			return true
+		}
+		if path.Base(dir) == ".git" {
+			return false
+		}
+	}
+	if (isDir && s.dirs[name]) || (!isDir && s.files[name]) {
+		return true
+	}
+	return s.untracked != nil && !s.untracked.ignored(relativePath, isDir)
+}
+
+// decide returns the decision leaving out the path if it is not a candidate
+func (s *gitSource) decide(relativePath string, isDir bool, path string) *Decision {
+	if s.candidate(relativePath, isDir) {
+		return nil
+	}
+	return &Decision{Ignored: true, Type: GitUntracked, Source: s.index, Path: path}
+}
+
+// gitIndexEntry is a single path of the git index
+type gitIndexEntry struct {
+	name string
+	mode uint32
+}
+
+// readGitIndex parses the entries of a git index file of version 2, 3 or 4.
+// The extensions are not needed and left out
+func readGitIndex(file string, hashSize int) ([]gitIndexEntry, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		// a fresh repository without any staged file has no index
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	invalid := func(reason string) error {
+		return fmt.Errorf("Invalid git index '%s': %s", file, reason)
+	}
+
+	if len(data) < 12 || !bytes.Equal(data[:4], []byte("DIRC")) {
+		return nil, invalid("missing signature")
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, invalid(fmt.Sprintf("unsupported version %d", version))
+	}
+	count := binary.BigEndian.Uint32(data[8:12])
+
+	// ctime, mtime, dev, ino, mode, uid, gid and size precede the object name and flags
+	const statSize = 40
+	entries := make([]gitIndexEntry, 0, count)
+	offset := 12
+	previous := ""
+	for i := uint32(0); i < count; i++ {
+		start := offset
+		offset += statSize + hashSize + 2
+		if offset > len(data) {
+			return nil, invalid("truncated entry")
+		}
+		mode := binary.BigEndian.Uint32(data[start+24 : start+28])
+		flags := binary.BigEndian.Uint16(data[offset-2 : offset])
+		if version >= 3 && flags&0x4000 != 0 {
+			offset += 2
+		}
+
+		var name string
+		if version == 4 {
+			// names are compressed against the previous one: a varint of bytes to strip and the rest
+			strip, n := gitVarint(data[offset:])
+			if n == 0 || strip > uint64(len(previous)) {
+				return nil, invalid("bad path prefix")
+			}
+			offset += n
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, invalid("unterminated path")
+			}
+			name = previous[:len(previous)-int(strip)] + string(data[offset:offset+end])
+			offset += end + 1
+		} else {
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, invalid("unterminated path")
+			}
+			name = string(data[offset : offset+end])
+			// entries are padded with 1 to 8 NULs to a multiple of 8 bytes
+			offset = start + ((offset + end - start + 8) &^ 7)
+		}
+		if offset > len(data) {
+			return nil, invalid("truncated entry")
+		}
+		entries = append(entries, gitIndexEntry{name: name, mode: mode})
+		previous = name
+	}
+	return entries, nil
+}
+
+// gitVarint decodes the offset encoding of git, it returns the value and the amount of read bytes
+func gitVarint(data []byte) (uint64, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	value := uint64(data[0] & 127)
+	n := 1
+	for data[n-1]&128 != 0 {
+		if n == len(data) {
+			return 0, 0
+		}
+		value = ((value + 1) << 7) | uint64(data[n]&127)
+		n++
+	}
+	return value, n
+}
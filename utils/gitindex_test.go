@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// gitIndex encodes a git index of the version holding the sorted files
+func gitIndex(version uint32, names []string) []byte {
+	var b bytes.Buffer
+	b.WriteString("DIRC")
+	binary.Write(&b, binary.BigEndian, version)
+	binary.Write(&b, binary.BigEndian, uint32(len(names)))
+	previous := ""
+	for _, name := range names {
+		start := b.Len()
+		stat := make([]byte, 40)
+		binary.BigEndian.PutUint32(stat[24:], 0100644)
+		b.Write(stat)
+		b.Write(make([]byte, 20))
+		binary.Write(&b, binary.BigEndian, uint16(len(name)))
+		if version == 4 {
+			common := 0
+			for common < len(previous) && common < len(name) && previous[common] == name[common] {
+				common++
+			}
+			b.WriteByte(byte(len(previous) - common))
+			b.WriteString(name[common:])
+			b.WriteByte(0)
+		} else {
+			b.WriteString(name)
+			b.Write(make([]byte, 8-(b.Len()-start)%8))
+		}
+		previous = name
+	}
+	return b.Bytes()
+}
+
+func Test_DriveIgnore_git(t *testing.T) {
+	req := require.New(t)
+	repository, err := ioutil.TempDir("", "driveignore_Test_DriveIgnore_git")
+	req.NoError(err)
+	defer os.RemoveAll(repository)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(repository, "config"))
+
+	testutil.WriteFiles(t, repository, map[string]string{
+		".gitignore":             "*.log\n",
+		"other.go":               "",
+		"input/.driveignore":     "*.secret\n",
+		"input/a.go":             "",
+		"input/b.secret":         "",
+		"input/sub/c.go":         "",
+		"input/sub/untracked.go": "",
+		"input/x.log":            "",
+	})
+	root := filepath.Join(repository, "input")
+
+	tests := []struct {
+		path      string
+		isDir     bool
+		tracked   bool
+		untracked bool
+	}{
+		{"a.go", false, true, true},
+		{"b.secret", false, false, false},
+		{"sub", true, true, true},
+		{"sub/c.go", false, true, true},
+		{"sub/untracked.go", false, false, true},
+		{"x.log", false, false, false},
+		{"empty", true, false, true},
+		{".git", true, false, false},
+	}
+	for _, version := range []uint32{2, 3, 4} {
+		index := gitIndex(version, []string{"input/.driveignore", "input/a.go", "input/b.secret", "input/sub/c.go", "other.go"})
+		testutil.WriteFiles(t, repository, map[string]string{".git/index": string(index)})
+
+		tracked, ignorer, err := DriveIgnore(root, IgnoreOptions{Git: GitTracked})
+		req.NoError(err)
+		req.Equal(LocalIgnore, ignorer)
+		untracked, _, err := DriveIgnore(root, IgnoreOptions{Git: GitTrackedUntracked})
+		req.NoError(err)
+
+		for _, tt := range tests {
+			path := filepath.Join(root, tt.path)
+			req.Equal(!tt.tracked, tracked.Match(path, tt.isDir), "tracked %d %s", version, tt.path)
+			req.Equal(!tt.untracked, untracked.Match(path, tt.isDir), "tracked+untracked %d %s", version, tt.path)
+		}
+		d := tracked.Explain(filepath.Join(root, "sub", "untracked.go"), false)
+		req.Equal(&Decision{Ignored: true, Type: GitUntracked, Source: filepath.Join(repository, ".git", "index"), Path: filepath.Join(root, "sub", "untracked.go")}, d)
+	}
+
+	value, n := gitVarint([]byte{0x80, 0x00})
+	req.Equal(uint64(128), value)
+	req.Equal(2, n)
+}
@@ -0,0 +1,103 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// LinkMode is the way files are put into the destination
+type LinkMode string
+
+const (
+	// LinkHard creates hard links, the source and destination share the content
+	LinkHard LinkMode = "hardlink"
+	// LinkReflink creates copy-on-write clones (btrfs, xfs)
+	LinkReflink LinkMode = "reflink"
+	// LinkCopy creates plain copies
+	LinkCopy LinkMode = "copy"
+	// LinkAuto tries a hard link, then a reflink and then a plain copy
+	LinkAuto LinkMode = "auto"
+	// LinkSymlink recreates a preserved symlink, it is never chosen by the user
+	LinkSymlink LinkMode = "symlink"
+)
+
+// ParseLinkMode validates the name of a link mode
+func ParseLinkMode(mode string) (LinkMode, error) {
+	switch LinkMode(mode) {
+	case LinkHard, LinkReflink, LinkCopy, LinkAuto:
+		return LinkMode(mode), nil
+	}
+	return "", configErrorf("Invalid link mode '%s', should be one of: hardlink, reflink, copy, auto", mode)
+}
+
+// Link creates goalPath out of currPath with the given mode.
+// It returns the method that was actually used which is never LinkAuto
+func Link(currPath string, goalPath string, mode LinkMode) (LinkMode, error) {
+	switch mode {
+	case LinkHard, "":
+		return LinkHard, os.Link(currPath, goalPath)
+	case LinkReflink:
+		return LinkReflink, copyFile(currPath, goalPath, reflink)
+	case LinkCopy:
+		return LinkCopy, copyFile(currPath, goalPath, plainCopy)
+	case LinkAuto:
+		err := os.Link(currPath, goalPath)
+		if err == nil || os.IsExist(err) {
+			return LinkHard, err
+		}
+		// cross device links, too many links or no hard links support at all
+		if err := copyFile(currPath, goalPath, reflink); err == nil {
+			return LinkReflink, nil
+		}
+		return LinkCopy, copyFile(currPath, goalPath, plainCopy)
+	}
+	return "", fmt.Errorf("Invalid link mode '%s'", mode)
+}
+
+func plainCopy(dst *os.File, src *os.File) error {
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+// copyFile creates goalPath and fills it with clone. The mode and modification time
+// of currPath are kept so that later runs can tell if any of the files changed
+func copyFile(currPath string, goalPath string, clone func(dst *os.File, src *os.File) error) error {
+	src, err := os.Open(currPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(goalPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := clone(dst, src); err != nil {
+		dst.Close()
+		os.Remove(goalPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(goalPath, info.ModTime(), info.ModTime())
+}
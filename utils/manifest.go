@@ -0,0 +1,146 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestFileName is the name of the file in the destination recording what driveignore created there
+const ManifestFileName = ".driveignore-state.json"
+
+// ManifestEntry is a single destination entry created by driveignore
+type ManifestEntry struct {
+	// Source is the absolute path of the input entry it came from
+	Source string `json:"source"`
+	// Method is how a file was created, empty for directories
+	Method LinkMode `json:"method,omitempty"`
+	// Size of the source when a copy was made
+	Size int64 `json:"size,omitempty"`
+	// ModTime of the source when a copy was made
+	ModTime int64 `json:"mtime,omitempty"`
+}
+
+// Manifest records every destination entry created by driveignore.
+// Only those entries are ever removed from the destination
+type Manifest struct {
+	path string
+	// Entries are keyed by the path relative to the destination
+	Entries map[string]ManifestEntry `json:"entries"`
+}
+
+// LoadManifest reads the manifest of the destination, a missing one is empty
+func LoadManifest(destination string) (*Manifest, error) {
+	m := &Manifest{
+		path:    filepath.Join(destination, ManifestFileName),
+		Entries: map[string]ManifestEntry{},
+	}
+
+	data, err := ioutil.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Entries == nil {
+		m.Entries = map[string]ManifestEntry{}
+	}
+	return m, nil
+}
+
+// Save writes the manifest back to the destination
+func (m *Manifest) Save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(m.path, append(data, '\n'), 0644)
+}
+
+// Owns reports whether the destination entry was created by driveignore
+func (m *Manifest) Owns(relativePath string) bool {
+	_, ok := m.Entries[relativePath]
+	return ok
+}
+
+// Record marks the destination entry as created by driveignore
+func (m *Manifest) Record(relativePath string, entry ManifestEntry) {
+	m.Entries[relativePath] = entry
+}
+
+// InSync reports whether the destination file has the content of the source file.
+// That is when they are the same hard link, when the destination is a copy
+// made by driveignore and none of them changed since or when both are symlinks
+// to the same target
+func (m *Manifest) InSync(relativePath string, source os.FileInfo, destination os.FileInfo) bool {
+	if os.SameFile(source, destination) {
+		return true
+	}
+	if source != nil && source.Mode()&os.ModeSymlink != 0 {
+		return m.sameSymlink(relativePath, destination)
+	}
+	return source != nil && m.unchangedCopy(relativePath, source) && m.Untouched(relativePath, destination)
+}
+
+// Untouched reports whether the destination file is a copy or a symlink made by driveignore
+// that was not modified since, so it can be safely replaced with a newer version of the source
+func (m *Manifest) Untouched(relativePath string, destination os.FileInfo) bool {
+	if destination == nil {
+		return false
+	}
+	if destination.Mode()&os.ModeSymlink != 0 {
+		return m.Entries[relativePath].Method == LinkSymlink
+	}
+	return m.unchangedCopy(relativePath, destination)
+}
+
+// sameSymlink reports whether the destination is a symlink created by driveignore
+// that still points where its source does
+func (m *Manifest) sameSymlink(relativePath string, destination os.FileInfo) bool {
+	entry, ok := m.Entries[relativePath]
+	if !ok || entry.Method != LinkSymlink || destination == nil || destination.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	source, err1 := os.Readlink(entry.Source)
+	goal, err2 := os.Readlink(filepath.Join(filepath.Dir(m.path), relativePath))
+	return err1 == nil && err2 == nil && source == goal
+}
+
+func (m *Manifest) unchangedCopy(relativePath string, info os.FileInfo) bool {
+	entry, ok := m.Entries[relativePath]
+	if !ok || (entry.Method != LinkCopy && entry.Method != LinkReflink) {
+		return false
+	}
+	return info.Size() == entry.Size && info.ModTime().UnixNano() == entry.ModTime
+}
+
+// Forget removes the entry, and everything inside of it for directories, from the manifest
+func (m *Manifest) Forget(relativePath string) {
+	delete(m.Entries, relativePath)
+	if strings.HasSuffix(relativePath, string(filepath.Separator)) {
+		for p := range m.Entries {
+			if strings.HasPrefix(p, relativePath) {
+				delete(m.Entries, p)
+			}
+		}
+	}
+}
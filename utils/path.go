@@ -15,37 +15,490 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+
+	gitignore "github.com/monochromegane/go-gitignore"
+)
+
+// SymlinkPolicy is what walks do with symbolic links
+type SymlinkPolicy string
+
+const (
+	// SymlinksPreserve passes the symlinks themselves, they are recreated in the destination
+	SymlinksPreserve SymlinkPolicy = "preserve"
+	// SymlinksFollow passes the targets of symlinks and enters symlinked directories
+	SymlinksFollow SymlinkPolicy = "follow"
+	// SymlinksSkip leaves symlinks out
+	SymlinksSkip SymlinkPolicy = "skip"
+	// SymlinksCopyTarget is SymlinksFollow where symlinked files are copied instead of linked
+	SymlinksCopyTarget SymlinkPolicy = "copy-target"
 )
 
-// Walker walks through a directory with some preset actions
-func Walker(path string, walk func(string, os.FileInfo, string) error) error {
-	return filepath.Walk(path, func(currPath string, info os.FileInfo, err error) error {
+// ParseSymlinkPolicy validates the name of a symlink policy
+func ParseSymlinkPolicy(policy string) (SymlinkPolicy, error) {
+	switch SymlinkPolicy(policy) {
+	case SymlinksPreserve, SymlinksFollow, SymlinksSkip, SymlinksCopyTarget:
+		return SymlinkPolicy(policy), nil
+	}
+	return "", configErrorf("Invalid symlink policy '%s', should be one of: preserve, follow, skip, copy-target", policy)
+}
+
+// follows reports whether symlinks are resolved to their targets
+func (s SymlinkPolicy) follows() bool {
+	return s == SymlinksFollow || s == SymlinksCopyTarget
+}
+
+// WalkOptions configure how walks treat symlinks, the zero value preserves them
+type WalkOptions struct {
+	Symlinks SymlinkPolicy `json:"symlinks,omitempty"`
+	// SymlinksOutside allows following symlinks that point outside of the walked directory
+	SymlinksOutside bool `json:"symlinksOutside,omitempty"`
+	// Root is the directory followed symlinks have to stay in, defaults to the walked directory
+	Root string `json:"-"`
+	// Jobs is the amount of directories read at once, all CPUs when not positive
+	Jobs int `json:"-"`
+	// Warn (if not nil) is called for every entry left out because of a problem with it,
+	// like a followed symlink pointing outside of the root
+	Warn func(error) `json:"-"`
+}
+
+// Lookup returns the info of the entry of root the way a walk of root with these options sees it
+func (o WalkOptions) Lookup(root string, relativePath string) (os.FileInfo, error) {
+	path := filepath.Join(root, relativePath)
+	notExist := &os.PathError{Op: "lstat", Path: path, Err: os.ErrNotExist}
+
+	// walks do not enter symlinked directories unless they follow them
+	if !o.Symlinks.follows() {
+		sep := string(filepath.Separator)
+		for dir := filepath.Dir(strings.TrimSuffix(relativePath, sep)); dir != "." && dir != sep; dir = filepath.Dir(dir) {
+			if info, err := os.Lstat(filepath.Join(root, dir)); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				return nil, notExist
+			}
+		}
+	}
+
+	return o.lookupEntry(path)
+}
+
+// lookupEntry is Lookup of path whose parent directories are known to be entered by walks
+func (o WalkOptions) lookupEntry(path string) (os.FileInfo, error) {
+	notExist := &os.PathError{Op: "lstat", Path: path, Err: os.ErrNotExist}
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return info, err
+	}
+	switch {
+	case o.Symlinks == SymlinksSkip:
+		return nil, notExist
+	case o.Symlinks.follows():
+		// broken links are kept as they are
+		if target, err := os.Stat(path); err == nil {
+			return target, nil
+		}
+	}
+	return info, nil
+}
+
+// notExist reports whether err says that an entry is not there,
+// which is also the case when one of its parents is a file
+func notExist(err error) bool {
+	var errno syscall.Errno
+	return os.IsNotExist(err) || (errors.As(err, &errno) && errno == syscall.ENOTDIR)
+}
+
+// lookup is WalkOptions.Lookup of a single root that remembers the directories
+// walks enter, so that looking up their entries takes a single stat
+type lookup struct {
+	root string
+	opts WalkOptions
+	dirs map[string]bool
+}
+
+func newLookup(root string, opts WalkOptions) *lookup {
+	return &lookup{root: root, opts: opts, dirs: map[string]bool{}}
+}
+
+func (l *lookup) stat(relativePath string) (os.FileInfo, error) {
+	relativePath = strings.TrimSuffix(relativePath, string(filepath.Separator))
+	var info os.FileInfo
+	var err error
+	if parent := filepath.Dir(relativePath); parent == "." || l.dirs[parent] {
+		info, err = l.opts.lookupEntry(filepath.Join(l.root, relativePath))
+	} else {
+		info, err = l.opts.Lookup(l.root, relativePath)
+	}
+	if err == nil && info.IsDir() {
+		l.dirs[relativePath] = true
+	}
+	return info, err
+}
+
+// Walker walks through a directory with some preset actions.
+// Entries are visited in lexical order, symlinks are treated according to opts.
+// Directories are read ahead by opts.Jobs workers, walk itself is never called concurrently.
+// A path that is not a directory is the only visited entry, relative to its parent directory
+func Walker(path string, opts WalkOptions, walk func(string, os.FileInfo, string) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		if info, err = os.Lstat(path); err != nil {
+			return err
+		}
+		if err := walk(path, info, filepath.Base(path)); err != filepath.SkipDir {
+			return err
+		}
+		return nil
+	}
+	if opts.Root == "" {
+		opts.Root = path
+	}
+	w := walker{root: path, opts: opts, walk: walk, branch: map[string]bool{}}
+	if opts.Symlinks.follows() {
+		if w.realRoot, err = filepath.EvalSymlinks(opts.Root); err != nil {
+			return err
+		}
+	}
+
+	if jobs := opts.jobs(); jobs > 1 {
+		w.queue = make(chan *listing, jobs*listingsPerJob)
+		w.slots = make(chan struct{}, jobs*listingsPerJob)
+		defer close(w.queue)
+		for i := 0; i < jobs; i++ {
+			go func() {
+				for l := range w.queue {
+					l.read()
+				}
+			}()
+		}
+	}
+	return w.dir(w.list(path))
+}
+
+// listingsPerJob bounds the directories read ahead but not walked yet
+const listingsPerJob = 16
+
+// jobs is the amount of workers reading directories, all CPUs by default
+func (o WalkOptions) jobs() int {
+	if o.Jobs > 0 {
+		return o.Jobs
+	}
+	return runtime.NumCPU()
+}
+
+type walker struct {
+	root     string
+	realRoot string
+	opts     WalkOptions
+	walk     func(string, os.FileInfo, string) error
+	// real paths of the directories being walked, used to detect symlink loops
+	branch map[string]bool
+	// directories to be read by the workers
+	queue chan *listing
+	// every directory read ahead takes a slot until it is walked
+	slots chan struct{}
+}
+
+// listing is the content of a directory, sorted by name
+type listing struct {
+	path    string
+	entries []os.FileInfo
+	err     error
+	done    chan struct{}
+	// slot says if the listing was read ahead and holds a slot
+	slot bool
+}
+
+// read lists the directory and stats all of its entries at once
+func (l *listing) read() {
+	defer close(l.done)
+	f, err := os.Open(l.path)
+	if err != nil {
+		l.err = err
+		return
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		l.err = err
+		return
+	}
+	sort.Strings(names)
+
+	l.entries = make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		info, err := os.Lstat(filepath.Join(l.path, name))
+		if os.IsNotExist(err) {
+			// removed in the meantime
+			continue
+		} else if err != nil {
+			l.err = err
+			return
+		}
+		l.entries = append(l.entries, info)
+	}
+}
+
+// list returns the listing of the directory, read right away
+func (w *walker) list(path string) *listing {
+	l := &listing{path: path, done: make(chan struct{})}
+	l.read()
+	return l
+}
+
+// prefetch returns the listing of the directory read by a worker,
+// or nil when too many directories were read ahead already
+func (w *walker) prefetch(path string) *listing {
+	if w.queue == nil {
+		return nil
+	}
+	select {
+	case w.slots <- struct{}{}:
+	default:
+		return nil
+	}
+	l := &listing{path: path, done: make(chan struct{}), slot: true}
+	w.queue <- l
+	return l
+}
+
+// release frees the slot of a listing read ahead once it is read
+func (w *walker) release(l *listing) {
+	if l == nil || !l.slot {
+		return
+	}
+	l.slot = false
+	go func() {
+		<-l.done
+		<-w.slots
+	}()
+}
+
+// dir walks the entries of a directory listing
+func (w *walker) dir(l *listing) error {
+	<-l.done
+	w.release(l)
+	if l.err != nil {
+		return l.err
+	}
+
+	if w.opts.Symlinks.follows() {
+		real, err := filepath.EvalSymlinks(l.path)
 		if err != nil {
 			return err
 		}
+		w.branch[real] = true
+		defer delete(w.branch, real)
+	}
+
+	// read the subdirectories while the entries before them are walked
+	ahead := map[string]*listing{}
+	for _, entry := range l.entries {
+		if entry.IsDir() {
+			if sub := w.prefetch(filepath.Join(l.path, entry.Name())); sub != nil {
+				ahead[entry.Name()] = sub
+			}
+		}
+	}
+	defer func() {
+		for _, sub := range ahead {
+			w.release(sub)
+		}
+	}()
+
+	for _, entry := range l.entries {
+		entryPath := filepath.Join(l.path, entry.Name())
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if w.opts.Symlinks == SymlinksSkip {
+				continue
+			}
+			var err error
+			if entry, err = w.follow(entryPath, entry); err != nil {
+				return err
+			} else if entry == nil {
+				continue
+			}
+		}
 
-		// skip the folder itself
-		if currPath == "." {
+		err := w.walk(entryPath, entry, RelativePath(w.root, entryPath, entry.IsDir()))
+		if err == filepath.SkipDir {
+			if entry.IsDir() {
+				continue
+			}
+			// skip the remaining entries of this directory
 			return nil
+		} else if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			sub, ok := ahead[filepath.Base(entryPath)]
+			if ok {
+				delete(ahead, filepath.Base(entryPath))
+			} else {
+				sub = w.list(entryPath)
+			}
+			if err := w.dir(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// follow returns the info of the symlink target if the policy follows symlinks.
+// Symlinks to directories that are being walked already return nil, they would loop forever,
+// so do the ones pointing outside of the root unless that is allowed
+func (w *walker) follow(linkPath string, link os.FileInfo) (os.FileInfo, error) {
+	if !w.opts.Symlinks.follows() {
+		return link, nil
+	}
+	target, err := os.Stat(linkPath)
+	if err != nil {
+		// broken links are kept as they are
+		return link, nil
+	}
+	real, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		return nil, err
+	}
+	if !w.opts.SymlinksOutside && !within(w.realRoot, real) {
+		if w.opts.Warn != nil {
+			w.opts.Warn(fmt.Errorf("Skipped symlink '%s' pointing outside of '%s', allow it with --symlinks-outside", linkPath, w.opts.Root))
+		}
+		return nil, nil
+	}
+	if target.IsDir() && w.branch[real] {
+		return nil, nil
+	}
+	return target, nil
+}
+
+// within reports whether path is root or inside of it
+func within(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// RelativePath returns currPath relative to root as passed to the walk callbacks,
+// directories get a trailing slash
+func RelativePath(root string, currPath string, isDir bool) string {
+	relativePath, _ := filepath.Rel(root, currPath)
+	if isDir {
+		relativePath += string(filepath.Separator)
+	}
+	return relativePath
+}
+
+// PathFilter limits a walk to the subtrees of the given relative paths, an empty filter keeps everything
+type PathFilter []string
+
+// NewPathFilter validates paths relative to the walked root
+func NewPathFilter(paths []string) (PathFilter, error) {
+	filter := make(PathFilter, 0, len(paths))
+	for _, path := range paths {
+		clean := filepath.Clean(path)
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return nil, configErrorf("Path '%s' should be relative to the input directory", path)
+		}
+		if clean == "." {
+			return PathFilter{}, nil
+		}
+		filter = append(filter, clean)
+	}
+	return filter, nil
+}
+
+// Walk is the decision of a walk callback about relativePath: whether it is inside of the filter
+// and the error to return otherwise (SkipDir for directories that do not lead to any of the paths)
+func (f PathFilter) Walk(relativePath string, isDir bool) (bool, error) {
+	if len(f) == 0 {
+		return true, nil
+	}
+	sep := string(filepath.Separator)
+	relativePath = strings.TrimSuffix(relativePath, sep)
+	for _, path := range f {
+		if relativePath == path || strings.HasPrefix(relativePath, path+sep) {
+			return true, nil
+		}
+	}
+	if !isDir {
+		return false, nil
+	}
+	for _, path := range f {
+		if strings.HasPrefix(path, relativePath+sep) {
+			return false, nil
 		}
+	}
+	return false, filepath.SkipDir
+}
 
-		relativePath, _ := filepath.Rel(path, currPath)
-		// adding slash to directories for print clarity
-		if temp, _ := os.Stat(currPath); temp.IsDir() {
-			relativePath += "\\"
+// IgnoreWalker is a Walker that does not enter the files and directories matched by driveignore.
+// skipped (if not nil) is called for every entry that got left out. A driveignore with an Err method
+// (like Ignorer) is checked once the walk is done, so that invalid rules found on the way are reported
+func IgnoreWalker(path string, driveignore gitignore.IgnoreMatcher, opts WalkOptions, skipped func(string, os.FileInfo, string), walk func(string, os.FileInfo, string) error) error {
+	err := Walker(path, opts, func(currPath string, info os.FileInfo, relativePath string) error {
+		if driveignore.Match(currPath, info.IsDir()) {
+			if skipped != nil {
+				skipped(currPath, info, relativePath)
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
 		return walk(currPath, info, relativePath)
 	})
+	if checked, ok := driveignore.(interface{ Err() error }); ok && err == nil {
+		err = checked.Err()
+	}
+	return err
 }
 
 // GlobalDriveignorePath returns absolute path to .global_driveignore
-func GlobalDriveignorePath() string {
+func GlobalDriveignorePath() (string, error) {
 	dir, err := os.UserConfigDir()
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+	return filepath.Join(dir, "/driveignore/.global_driveignore"), nil
+}
+
+// legacyGlobalDriveignorePath is where .global_driveignore used to be read from:
+// the root of the driveignore sources the binary was built from
+var legacyGlobalDriveignorePath = func() string {
+	_, currFile, _, ok := runtime.Caller(0)
+	if !ok {
+		return ""
+	}
+	return filepath.Join(currFile, "../../.global_driveignore")
+}()
+
+// LegacyGlobalDriveignorePath returns the old location of .global_driveignore,
+// it is still read as long as there is none in the user config directory
+func LegacyGlobalDriveignorePath() string {
+	return legacyGlobalDriveignorePath
+}
+
+// globalDriveignoreFile returns the path of the global .driveignore to read,
+// the legacy one when it was not moved to the user config directory yet
+func globalDriveignoreFile() (string, error) {
+	global, err := GlobalDriveignorePath()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(global); os.IsNotExist(err) && legacyGlobalDriveignorePath != "" {
+		if _, err := os.Stat(legacyGlobalDriveignorePath); err == nil {
+			return legacyGlobalDriveignorePath, nil
+		}
 	}
-	return filepath.Join(dir, "/driveignore/.global_driveignore")
+	return global, nil
 }
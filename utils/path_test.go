@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Walker_symlinks(t *testing.T) {
+	req := require.New(t)
+	root, err := ioutil.TempDir("", "driveignore_Test_Walker_symlinks")
+	req.NoError(err)
+	defer os.RemoveAll(root)
+	outside, err := ioutil.TempDir("", "driveignore_Test_Walker_symlinks_outside")
+	req.NoError(err)
+	defer os.RemoveAll(outside)
+
+	testutil.WriteFiles(t, root, map[string]string{"real/file": "content", "loop/file": ""})
+	testutil.WriteFiles(t, outside, map[string]string{"secret": ""})
+	links := map[string]string{
+		"dir":     "real",
+		"file":    filepath.Join("real", "file"),
+		"loop/up": "..",
+		"broken":  "nowhere",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("symlinks are not supported:", err)
+		}
+	}
+
+	sep := string(filepath.Separator)
+	tests := []struct {
+		opts     WalkOptions
+		expected []string
+	}{
+		{WalkOptions{}, []string{"broken", "dir", "file", "loop" + sep, filepath.Join("loop", "file"), filepath.Join("loop", "up"), "real" + sep, filepath.Join("real", "file")}},
+		{WalkOptions{Symlinks: SymlinksSkip}, []string{"loop" + sep, filepath.Join("loop", "file"), "real" + sep, filepath.Join("real", "file")}},
+		{WalkOptions{Symlinks: SymlinksFollow}, []string{"broken", "dir" + sep, filepath.Join("dir", "file"), "file", "loop" + sep, filepath.Join("loop", "file"), "real" + sep, filepath.Join("real", "file")}},
+	}
+	for _, test := range tests {
+		var walked []string
+		err := Walker(root, test.opts, func(currPath string, info os.FileInfo, relativePath string) error {
+			walked = append(walked, relativePath)
+			return nil
+		})
+		req.NoError(err, test.opts.Symlinks)
+		req.Equal(test.expected, walked, test.opts.Symlinks)
+
+		// entries inside of symlinked directories only exist when they are followed
+		_, err = test.opts.Lookup(root, filepath.Join("dir", "file"))
+		req.Equal(!test.opts.Symlinks.follows(), os.IsNotExist(err), test.opts.Symlinks)
+	}
+
+	// following links out of the walked directory has to be allowed, otherwise they are skipped
+	req.NoError(os.Symlink(outside, filepath.Join(root, "outside")))
+	var warnings []error
+	var walked []string
+	err = Walker(root, WalkOptions{Symlinks: SymlinksFollow, Warn: func(err error) { warnings = append(warnings, err) }}, func(currPath string, info os.FileInfo, relativePath string) error {
+		walked = append(walked, relativePath)
+		return nil
+	})
+	req.NoError(err)
+	req.Len(warnings, 1)
+	req.NotContains(walked, "outside"+sep)
+	req.Contains(walked, filepath.Join("real", "file"))
+	walked = nil
+	err = Walker(root, WalkOptions{Symlinks: SymlinksFollow, SymlinksOutside: true}, func(currPath string, info os.FileInfo, relativePath string) error {
+		walked = append(walked, relativePath)
+		return nil
+	})
+	req.NoError(err)
+	req.Contains(walked, filepath.Join("outside", "secret"))
+}
+
+func Test_Walker_file(t *testing.T) {
+	req := require.New(t)
+	root, err := ioutil.TempDir("", "driveignore_Test_Walker_file")
+	req.NoError(err)
+	defer os.RemoveAll(root)
+	testutil.WriteFiles(t, root, map[string]string{"file": "content"})
+
+	var walked []string
+	err = Walker(filepath.Join(root, "file"), WalkOptions{}, func(currPath string, info os.FileInfo, relativePath string) error {
+		req.False(info.IsDir())
+		walked = append(walked, relativePath)
+		return nil
+	})
+	req.NoError(err)
+	req.Equal([]string{"file"}, walked)
+}
+
+func Test_Walker_jobs(t *testing.T) {
+	req := require.New(t)
+	root, err := ioutil.TempDir("", "driveignore_Test_Walker_jobs")
+	req.NoError(err)
+	defer os.RemoveAll(root)
+
+	files := map[string]string{}
+	for _, dir := range []string{"a", "b", "c", "skip"} {
+		for _, sub := range []string{"x", "y", "z"} {
+			for _, file := range []string{"1", "2", "3"} {
+				files[filepath.Join(dir, sub, file)] = ""
+			}
+		}
+	}
+	testutil.WriteFiles(t, root, files)
+
+	walk := func(jobs int) []string {
+		var walked []string
+		err := Walker(root, WalkOptions{Jobs: jobs}, func(currPath string, info os.FileInfo, relativePath string) error {
+			walked = append(walked, relativePath)
+			if relativePath == "skip"+string(filepath.Separator) {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		req.NoError(err)
+		return walked
+	}
+	sequential := walk(1)
+	req.Len(sequential, 3+3*3+3*3*3+1)
+	for _, jobs := range []int{2, 8} {
+		req.Equal(sequential, walk(jobs), jobs)
+	}
+
+	// the operations are applied by many workers
+	destination, err := ioutil.TempDir("", "driveignore_Test_Walker_jobs_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+	driveignore := &Ignorer{root: root, nested: map[string]rules{}}
+	opts := PlanOptions{WalkOptions: WalkOptions{Jobs: 8}}
+	plan, err := PlanUnify(root, destination, driveignore, opts)
+	req.NoError(err)
+	req.NoError(plan.Apply(nil))
+	plan, err = PlanUnify(root, destination, driveignore, opts)
+	req.NoError(err)
+	req.Empty(plan.Operations)
+}
+
+func Test_PathFilter(t *testing.T) {
+	req := require.New(t)
+	sep := string(filepath.Separator)
+
+	filter, err := NewPathFilter([]string{"docs", filepath.Join("src", "main.go")})
+	req.NoError(err)
+
+	tests := []struct {
+		relativePath string
+		isDir        bool
+		want         bool
+		wantErr      error
+	}{
+		{"docs" + sep, true, true, nil},
+		{filepath.Join("docs", "a.md"), false, true, nil},
+		{"src" + sep, true, false, nil},
+		{filepath.Join("src", "main.go"), false, true, nil},
+		{filepath.Join("src", "other.go"), false, false, nil},
+		{"vendor" + sep, true, false, filepath.SkipDir},
+		{"docs.md", false, false, nil},
+	}
+	for _, tt := range tests {
+		got, err := filter.Walk(tt.relativePath, tt.isDir)
+		req.Equal(tt.want, got, tt.relativePath)
+		req.Equal(tt.wantErr, err, tt.relativePath)
+	}
+
+	all, err := NewPathFilter([]string{"docs", "."})
+	req.NoError(err)
+	got, err := all.Walk("vendor"+sep, true)
+	req.True(got)
+	req.NoError(err)
+
+	_, err = NewPathFilter([]string{filepath.Join("..", "outside")})
+	req.Error(err)
+}
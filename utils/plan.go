@@ -0,0 +1,745 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	gitignore "github.com/monochromegane/go-gitignore"
+)
+
+// OpKind is the kind of a single filesystem operation
+type OpKind string
+
+const (
+	// OpMkdir creates a directory in the destination
+	OpMkdir OpKind = "mkdir"
+	// OpLink creates a hard link to a source file in the destination
+	OpLink OpKind = "link"
+	// OpReplace replaces a destination file with a hard link to the source file
+	OpReplace OpKind = "replace"
+	// OpRemove removes a file or a whole directory from the destination
+	OpRemove OpKind = "remove"
+	// OpRecord records an already uploaded entry in the manifest without touching it
+	OpRecord OpKind = "record"
+	// OpRestore replaces the source file with the destination one and links them again
+	OpRestore OpKind = "restore"
+)
+
+// FileState is a fingerprint of a file used to detect changes made after planning
+type FileState struct {
+	IsDir   bool  `json:"dir,omitempty"`
+	Size    int64 `json:"size,omitempty"`
+	ModTime int64 `json:"mtime,omitempty"`
+}
+
+func fileState(info os.FileInfo) *FileState {
+	// directory mtimes change with every entry inside of them, their existence is enough
+	if info.IsDir() {
+		return &FileState{IsDir: true}
+	}
+	return &FileState{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+}
+
+func (s *FileState) equal(other *FileState) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	return *s == *other
+}
+
+// Operation is a single change of the destination directory
+type Operation struct {
+	Kind OpKind `json:"op"`
+	// Path is relative to both the input and the destination
+	Path string `json:"path"`
+	// Source is the state of the input entry when planned
+	Source *FileState `json:"source,omitempty"`
+	// Destination is the state of the destination entry when planned
+	Destination *FileState `json:"destination,omitempty"`
+	// Method is how the file was created, only set for applied operations
+	Method LinkMode `json:"method,omitempty"`
+}
+
+// rank is the position of the operation in a sorted plan
+func (op Operation) rank() int {
+	switch op.Kind {
+	case OpMkdir, OpLink, OpRecord:
+		return 0
+	case OpReplace, OpRestore:
+		// directories replacing files have to exist before their entries are created
+		if op.Source != nil && op.Source.IsDir {
+			return 0
+		}
+		return 1
+	}
+	return 2
+}
+
+func (op Operation) equal(other Operation) bool {
+	return op.Kind == other.Kind && op.Path == other.Path &&
+		op.Source.equal(other.Source) && op.Destination.equal(other.Destination)
+}
+
+// PlanOptions configure how plans are computed
+type PlanOptions struct {
+	WalkOptions
+	// LinkMode is how files are put into the destination
+	LinkMode LinkMode
+	// Force replaces files with the same name but different content
+	Force bool
+	// Skipped (if not nil) is called for every entry left out because of the .driveignores
+	Skipped func(string, os.FileInfo, string)
+	// Ignored (if not nil) makes clean remove the destination entries it matches,
+	// like the ones uploaded before a .driveignore started to ignore them
+	Ignored gitignore.IgnoreMatcher
+}
+
+// Plan is the set of operations needed to mirror input into destination
+type Plan struct {
+	Input        string   `json:"input"`
+	Destination  string   `json:"destination"`
+	MergeIgnores bool     `json:"mergeIgnores"`
+	UseGitignore bool     `json:"useGitignore,omitempty"`
+	Git          GitMode  `json:"git,omitempty"`
+	CleanIgnored bool     `json:"cleanIgnored,omitempty"`
+	LinkMode     LinkMode `json:"linkMode,omitempty"`
+	WalkOptions
+	Operations []Operation `json:"operations"`
+	// Conflicts are files with the same name but different content that will not be replaced
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Trash (if not empty) is where removed entries are moved to instead of being deleted
+	Trash string `json:"-"`
+
+	manifest *Manifest
+	ignored  gitignore.IgnoreMatcher
+	// lookups of input and destination entries while planning
+	inputs *lookup
+	goals  *lookup
+	// trash entry of the removals, created with the first one
+	trashOnce  sync.Once
+	trashEntry *TrashEntry
+	trashErr   error
+}
+
+func newPlan(input string, destination string, opts PlanOptions) (*Plan, error) {
+	manifest, err := LoadManifest(destination)
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{
+		Input:        input,
+		Destination:  destination,
+		LinkMode:     opts.LinkMode,
+		WalkOptions:  opts.WalkOptions,
+		CleanIgnored: opts.Ignored != nil,
+		Operations:   []Operation{},
+		manifest:     manifest,
+		ignored:      opts.Ignored,
+		inputs:       newLookup(input, opts.WalkOptions),
+		goals:        newLookup(destination, WalkOptions{}),
+	}, nil
+}
+
+func (p *Plan) add(kind OpKind, relativePath string, source os.FileInfo, destination os.FileInfo) {
+	op := Operation{Kind: kind, Path: relativePath}
+	if source != nil {
+		op.Source = fileState(source)
+	}
+	if destination != nil {
+		op.Destination = fileState(destination)
+	}
+	p.Operations = append(p.Operations, op)
+}
+
+// PlanUpload computes the operations that hard link the input files into destination.
+// Files with the same name but different content are replaced only if opts.Force is set
+func PlanUpload(input string, destination string, driveignore gitignore.IgnoreMatcher, opts PlanOptions) (*Plan, error) {
+	plan, err := newPlan(input, destination, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = IgnoreWalker(input, driveignore, opts.WalkOptions, opts.Skipped, func(currPath string, info os.FileInfo, relativePath string) error {
+		return plan.addUpload(currPath, info, relativePath, opts.Force)
+	})
+	return plan, err
+}
+
+// addUpload plans the upload of a single input entry
+func (p *Plan) addUpload(currPath string, info os.FileInfo, relativePath string, force bool) error {
+	// the destination is looked up as is, its symlinks are never entered.
+	// Below a file that gets replaced by a directory there is nothing yet
+	goalStat, err := p.goals.stat(relativePath)
+	if notExist(err) {
+		if info.IsDir() {
+			p.add(OpMkdir, relativePath, info, nil)
+		} else {
+			p.add(OpLink, relativePath, info, nil)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// if same name file already exists, check if its the same hardlink or an unchanged copy, then ignore
+	// copies made by driveignore that were not modified since can be always replaced
+	if info.IsDir() != goalStat.IsDir() || (!info.IsDir() && !p.manifest.InSync(relativePath, info, goalStat)) {
+		if force || p.manifest.Untouched(relativePath, goalStat) {
+			p.add(OpReplace, relativePath, info, goalStat)
+		} else {
+			p.Conflicts = append(p.Conflicts, relativePath)
+		}
+	} else if !p.manifest.Owns(relativePath) {
+		// uploaded before the manifest existed
+		p.add(OpRecord, relativePath, info, goalStat)
+	}
+	return nil
+}
+
+// PlanClean computes the operations that remove destination entries not existing in input.
+// Only entries recorded in the manifest are removed, files put there by others are kept.
+// Input entries are looked up with opts.WalkOptions so that skipped symlinks count as missing
+func PlanClean(input string, destination string, opts PlanOptions) (*Plan, error) {
+	plan, err := newPlan(input, destination, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, plan.addCleanTree(destination)
+}
+
+// addCleanTree plans the removal of legacy entries of path, the destination or an entry inside of it
+func (p *Plan) addCleanTree(path string) error {
+	sep := string(filepath.Separator)
+	var legacy []Operation
+	// directories with entries that are kept
+	kept := map[string]bool{}
+	visit := func(currPath string, info os.FileInfo, _ string) error {
+		relativePath := RelativePath(p.Destination, currPath, info.IsDir())
+		if relativePath == ManifestFileName {
+			return nil
+		}
+
+		isLegacy, err := p.legacy(info, relativePath)
+		if err != nil {
+			return err
+		}
+		if (isLegacy || p.ignoredEntry(relativePath, info.IsDir())) && p.manifest.Owns(relativePath) {
+			legacy = append(legacy, Operation{Kind: OpRemove, Path: relativePath, Destination: fileState(info)})
+			return nil
+		}
+		for dir := filepath.Dir(strings.TrimSuffix(relativePath, sep)); dir != "."; dir = filepath.Dir(dir) {
+			kept[dir+sep] = true
+		}
+		return nil
+	}
+
+	// walks visit the entries of directories but not the directories themselves
+	if info, err := os.Lstat(path); err != nil {
+		return err
+	} else if path != p.Destination && info.IsDir() {
+		if err := visit(path, info, ""); err != nil {
+			return err
+		}
+	}
+	// the destination is walked as is, followed symlinks are real directories there
+	if err := Walker(path, WalkOptions{Jobs: p.Jobs}, visit); err != nil {
+		return err
+	}
+
+	// legacy directories are only removed once they are empty, the ones with kept entries stay
+	for _, op := range legacy {
+		if strings.HasSuffix(op.Path, sep) && kept[op.Path] {
+			continue
+		}
+		p.Operations = append(p.Operations, op)
+	}
+	return nil
+}
+
+// ignoredEntry reports whether the destination entry or one of its parents is matched by the Ignored option
+func (p *Plan) ignoredEntry(relativePath string, isDir bool) bool {
+	if p.ignored == nil {
+		return false
+	}
+	sep := string(filepath.Separator)
+	parts := strings.Split(strings.TrimSuffix(relativePath, sep), sep)
+	for i := range parts {
+		last := i == len(parts)-1
+		if p.ignored.Match(filepath.Join(p.Input, filepath.Join(parts[:i+1]...)), isDir || !last) {
+			return true
+		}
+	}
+	return false
+}
+
+// legacy reports whether the destination entry does not exist in input
+func (p *Plan) legacy(info os.FileInfo, relativePath string) (bool, error) {
+	// check if file/directory exists in source folder, a file in place of one of its parents counts as missing
+	sourceStat, err := p.inputs.stat(relativePath)
+	if notExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return sourceStat.IsDir() != info.IsDir() ||
+		(!info.IsDir() && !p.manifest.InSync(relativePath, sourceStat, info)), nil
+}
+
+// PlanUnify computes the operations of a forced upload followed by a clean
+func PlanUnify(input string, destination string, driveignore gitignore.IgnoreMatcher, opts PlanOptions) (*Plan, error) {
+	opts.Force = true
+	plan, err := PlanUpload(input, destination, driveignore, opts)
+	if err != nil {
+		return nil, err
+	}
+	clean, err := PlanClean(input, destination, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// replaced files would also be seen as legacy by clean, just like
+	// everything inside of a directory that got replaced by a file
+	var replaced []string
+	for _, op := range plan.Operations {
+		if op.Kind == OpReplace {
+			replaced = append(replaced, strings.TrimSuffix(op.Path, string(filepath.Separator)))
+		}
+	}
+	for _, op := range clean.Operations {
+		path := strings.TrimSuffix(op.Path, string(filepath.Separator))
+		if !contains(replaced, path) && !hasParent(replaced, path) {
+			plan.Operations = append(plan.Operations, op)
+		}
+	}
+
+	plan.sort()
+	return plan, nil
+}
+
+// PlanPaths computes the operations of unify limited to the passed paths (relative to input).
+// Existing directories are planned with everything inside of them, paths no longer existing
+// in input are removed from destination
+func PlanPaths(input string, destination string, driveignore *Ignorer, relativePaths []string, opts PlanOptions) (*Plan, error) {
+	// symlinks inside of the passed directories still have to stay in input
+	if opts.Root == "" {
+		opts.Root = input
+	}
+	plan, err := newPlan(input, destination, opts)
+	if err != nil {
+		return nil, err
+	}
+	planned := map[string]bool{}
+	upload := func(currPath string, info os.FileInfo, _ string) error {
+		relativePath := RelativePath(input, currPath, info.IsDir())
+		if planned[relativePath] {
+			return nil
+		}
+		planned[relativePath] = true
+		return plan.addUpload(currPath, info, relativePath, true)
+	}
+
+	// parents go first so that their removal covers the children
+	sort.Strings(relativePaths)
+	var cleaned []string
+	for _, relativePath := range relativePaths {
+		currPath := filepath.Join(input, relativePath)
+		info, err := plan.inputs.stat(relativePath)
+		if notExist(err) {
+			goalPath := filepath.Join(destination, relativePath)
+			if _, err := os.Lstat(goalPath); err != nil || hasParent(cleaned, goalPath) {
+				continue
+			}
+			cleaned = append(cleaned, goalPath)
+			if err := plan.addCleanTree(goalPath); err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if d := driveignore.Explain(currPath, info.IsDir()); d != nil && d.Ignored {
+			continue
+		}
+		if err := upload(currPath, info, ""); err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			if err := IgnoreWalker(currPath, driveignore, opts.WalkOptions, nil, upload); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// the passed paths themselves are only explained, nested .driveignores read for them are checked here
+	if err := driveignore.Err(); err != nil {
+		return nil, err
+	}
+	plan.sort()
+	return plan, nil
+}
+
+// hasParent reports whether any of the parents contains path
+func hasParent(parents []string, path string) bool {
+	for _, parent := range parents {
+		if strings.HasPrefix(path, parent+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// sort orders the operations so that creates go first, then replaces and deletes last
+func (p *Plan) sort() {
+	sort.SliceStable(p.Operations, func(i, j int) bool {
+		return p.Operations[i].rank() < p.Operations[j].rank()
+	})
+}
+
+// Changed reports whether the operations of the plans differ
+func (p *Plan) Changed(other *Plan) bool {
+	if len(p.Operations) != len(other.Operations) {
+		return true
+	}
+	for i := range p.Operations {
+		if !p.Operations[i].equal(other.Operations[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply performs the operations and records them in the manifest of the destination.
+// Directories are created first and removed last, one by one and the deepest ones first.
+// The other operations run on Jobs workers, consecutive operations of the same rank at a time,
+// so creates still go before replaces and deletes.
+// done is called after every performed operation, never concurrently. A failed operation does not
+// stop the others, all failures are returned together as an *ApplyError. Without a Trash a file
+// only replaces a directory when everything inside of it was created by driveignore
+func (p *Plan) Apply(done func(Operation)) (err error) {
+	if p.manifest == nil {
+		if p.manifest, err = LoadManifest(p.Destination); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if len(p.Operations) == 0 {
+			return
+		}
+		if saveErr := p.manifest.Save(); err == nil {
+			err = saveErr
+		}
+		if p.trashEntry == nil {
+			return
+		}
+		if saveErr := p.trashEntry.save(); err == nil {
+			err = saveErr
+		}
+	}()
+
+	var mu sync.Mutex
+	var failures []*OperationError
+	perform := func(op Operation) {
+		entry, err := p.perform(op)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failures = append(failures, &OperationError{op, err})
+			return
+		}
+		if recorded, ok := p.manifest.Entries[op.Path]; ok && p.Trash != "" && (op.Kind == OpRemove || op.Kind == OpReplace) {
+			// the trash entry exists as something was moved there
+			if trashEntry, err := p.openTrash(); err == nil {
+				trashEntry.remember(op.Path, recorded)
+			}
+		}
+		if op.Kind == OpRemove {
+			p.manifest.Forget(op.Path)
+		} else {
+			p.manifest.Record(op.Path, entry)
+		}
+		op.Method = entry.Method
+		if done != nil {
+			done(op)
+		}
+	}
+
+	// directories have to exist before anything is put inside of them
+	// and have to be empty before they are removed
+	var rest, removedDirs []Operation
+	for _, op := range p.Operations {
+		switch {
+		case op.createsDir():
+			perform(op)
+		case op.removesDir():
+			removedDirs = append(removedDirs, op)
+		case op.replacesDir() && p.Trash == "":
+			// without a trash nothing driveignore did not create can be brought back, such directories are kept
+			if err := p.ownsTree(op.Path); err != nil {
+				failures = append(failures, &OperationError{op, err})
+				continue
+			}
+			rest = append(rest, op)
+		default:
+			rest = append(rest, op)
+		}
+	}
+	for start := 0; start < len(rest); {
+		end := start
+		for end < len(rest) && rest[end].rank() == rest[start].rank() {
+			end++
+		}
+		parallel(rest[start:end], p.jobs(), perform)
+		start = end
+	}
+	sort.SliceStable(removedDirs, func(i, j int) bool {
+		return removedDirs[i].Path > removedDirs[j].Path
+	})
+	for _, op := range removedDirs {
+		perform(op)
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].Operation.Path < failures[j].Operation.Path
+	})
+	return &ApplyError{Failures: failures, Operations: len(p.Operations)}
+}
+
+// createsDir reports whether the operation creates a directory in the destination
+func (op Operation) createsDir() bool {
+	return op.Kind == OpMkdir || (op.Kind == OpReplace && op.Source != nil && op.Source.IsDir)
+}
+
+// removesDir reports whether the operation removes a directory from the destination
+func (op Operation) removesDir() bool {
+	return op.Kind == OpRemove && op.Destination != nil && op.Destination.IsDir
+}
+
+// replacesDir reports whether the operation puts a file in place of a destination directory
+func (op Operation) replacesDir() bool {
+	return op.Kind == OpReplace && (op.Source == nil || !op.Source.IsDir) && op.Destination != nil && op.Destination.IsDir
+}
+
+// ownsTree returns an error naming an entry of the destination directory at relativePath
+// (or the directory itself) that is not recorded in the manifest
+func (p *Plan) ownsTree(relativePath string) error {
+	sep := string(filepath.Separator)
+	dir := strings.TrimSuffix(relativePath, sep) + sep
+	foreign := ""
+	if !p.manifest.Owns(dir) {
+		foreign = dir
+	}
+	err := Walker(filepath.Join(p.Destination, dir), WalkOptions{Jobs: p.Jobs}, func(currPath string, info os.FileInfo, _ string) error {
+		if entryPath := RelativePath(p.Destination, currPath, info.IsDir()); foreign == "" && !p.manifest.Owns(entryPath) {
+			foreign = entryPath
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if foreign != "" {
+		return fmt.Errorf("Cannot replace '%s' without a trash, '%s' was not created by driveignore", dir, foreign)
+	}
+	return nil
+}
+
+// parallel calls perform for every operation on jobs workers
+func parallel(ops []Operation, jobs int, perform func(Operation)) {
+	if jobs > len(ops) {
+		jobs = len(ops)
+	}
+	if jobs <= 1 {
+		for _, op := range ops {
+			perform(op)
+		}
+		return
+	}
+
+	queue := make(chan Operation)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for op := range queue {
+				perform(op)
+			}
+		}()
+	}
+	for _, op := range ops {
+		queue <- op
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// perform changes the filesystem according to the operation and returns its manifest entry
+func (p *Plan) perform(op Operation) (ManifestEntry, error) {
+	currPath := filepath.Join(p.Input, op.Path)
+	goalPath := filepath.Join(p.Destination, op.Path)
+
+	source, _ := filepath.Abs(currPath)
+	entry := ManifestEntry{Source: source}
+
+	var err error
+	switch op.Kind {
+	case OpMkdir:
+		err = os.MkdirAll(goalPath, os.ModePerm)
+	case OpLink:
+		entry.Method, err = p.link(currPath, goalPath)
+	case OpReplace:
+		if op.Source != nil && op.Source.IsDir {
+			// a directory cannot be renamed over a file
+			if err = p.remove(op.Path, false); err == nil {
+				err = os.MkdirAll(goalPath, os.ModePerm)
+			}
+		} else {
+			entry.Method, err = p.replace(currPath, op.Path, op.Destination != nil && op.Destination.IsDir)
+		}
+	case OpRestore:
+		entry.Method, err = p.restore(currPath, goalPath)
+	case OpRemove:
+		err = p.remove(op.Path, op.Destination != nil && op.Destination.IsDir)
+	case OpRecord:
+		if op.Source != nil && !op.Source.IsDir {
+			entry.Method = LinkHard
+		}
+	default:
+		err = fmt.Errorf("unknown operation '%s'", op.Kind)
+	}
+	if err != nil {
+		return entry, err
+	}
+
+	// copies are recognized by the state of the source they were made of
+	if entry.Method == LinkCopy || entry.Method == LinkReflink {
+		if info, err := os.Stat(currPath); err == nil {
+			entry.Size, entry.ModTime = info.Size(), info.ModTime().UnixNano()
+		}
+	}
+	return entry, nil
+}
+
+// remove deletes the destination entry, with a trash it is moved there instead.
+// Directories are only removed when they are empty, their entries are removed by their own operations
+func (p *Plan) remove(relativePath string, isDir bool) error {
+	if p.Trash == "" {
+		return os.Remove(filepath.Join(p.Destination, relativePath))
+	}
+	entry, err := p.openTrash()
+	if err != nil {
+		return err
+	}
+	return entry.add(relativePath, isDir)
+}
+
+// openTrash returns the trash entry of the run, it is created when the first entry is moved there
+func (p *Plan) openTrash() (*TrashEntry, error) {
+	p.trashOnce.Do(func() {
+		p.trashEntry, p.trashErr = Trash{Path: p.Trash}.create(p.Destination)
+	})
+	return p.trashEntry, p.trashErr
+}
+
+// Trashed returns the trash entry the removed entries were moved to, nil if nothing was
+func (p *Plan) Trashed() *TrashEntry {
+	return p.trashEntry
+}
+
+// link puts the input file into the destination according to the link mode and symlink policy
+func (p *Plan) link(currPath string, goalPath string) (LinkMode, error) {
+	info, err := os.Lstat(currPath)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return Link(currPath, goalPath, p.LinkMode)
+	}
+
+	// broken links are preserved
+	if target, err := filepath.EvalSymlinks(currPath); err == nil && p.Symlinks.follows() {
+		if p.Symlinks == SymlinksCopyTarget {
+			return Link(target, goalPath, LinkCopy)
+		}
+		return Link(target, goalPath, p.LinkMode)
+	}
+	target, err := os.Readlink(currPath)
+	if err != nil {
+		return "", err
+	}
+	return LinkSymlink, os.Symlink(target, goalPath)
+}
+
+// replace puts the input file in place of the destination entry, with a trash the old entry is moved there.
+// The link is made next to the destination first so that a failed link leaves it untouched
+func (p *Plan) replace(currPath string, relativePath string, isDir bool) (LinkMode, error) {
+	goalPath := filepath.Join(p.Destination, relativePath)
+	temp := goalPath + ".driveignore-replace"
+	method, err := p.link(currPath, temp)
+	if err == nil && p.Trash != "" {
+		var entry *TrashEntry
+		if entry, err = p.openTrash(); err == nil {
+			// directories are moved along with their entries
+			err = entry.add(relativePath, false)
+		}
+	} else if err == nil && isDir {
+		// Apply made sure driveignore created everything inside of it
+		err = os.RemoveAll(goalPath)
+	}
+	if err == nil {
+		err = os.Rename(temp, goalPath)
+	}
+	if err != nil {
+		os.Remove(temp)
+		return "", err
+	}
+	return method, nil
+}
+
+// restore replaces the input file with the destination file linked with the link mode.
+// The link is made next to the input file first so that it is never lost
+func (p *Plan) restore(currPath string, goalPath string) (LinkMode, error) {
+	temp := currPath + ".driveignore-restore"
+	method, err := Link(goalPath, temp, p.LinkMode)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(temp, currPath); err != nil {
+		os.Remove(temp)
+		return "", err
+	}
+	return method, nil
+}
@@ -0,0 +1,419 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PlanUnify(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_PlanUnify_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_PlanUnify_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	testutil.WriteFiles(t, input, map[string]string{
+		".driveignore": "*.log\n",
+		"a/new.txt":    "new",
+		"changed.txt":  "source",
+		"x.log":        "ignored",
+	})
+	sep := string(filepath.Separator)
+	testutil.WriteFiles(t, destination, map[string]string{
+		"changed.txt":   "destination",
+		"old/file":      "old",
+		"mixed/file":    "old",
+		"mixed/foreign": "put there by someone else",
+		"foreign":       "put there by someone else",
+	})
+	manifest, err := LoadManifest(destination)
+	req.NoError(err)
+	for _, p := range []string{"old" + sep, "old" + sep + "file", "mixed" + sep, "mixed" + sep + "file"} {
+		manifest.Record(p, ManifestEntry{})
+	}
+	req.NoError(manifest.Save())
+	driveignore := &Ignorer{root: input, base: testRules(t, "*.log\n", input), nested: map[string]rules{}}
+
+	plan, err := PlanUnify(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+
+	var ops []string
+	for _, op := range plan.Operations {
+		ops = append(ops, string(op.Kind)+" "+op.Path)
+	}
+	req.Equal([]string{
+		"link .driveignore",
+		"mkdir a" + sep,
+		"link a" + sep + "new.txt",
+		"replace changed.txt",
+		"remove mixed" + sep + "file",
+		"remove old" + sep,
+		"remove old" + sep + "file",
+	}, ops)
+
+	// planning again without changes gives the same plan
+	again, err := PlanUnify(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.False(plan.Changed(again))
+
+	// a new file makes the plan outdated
+	testutil.WriteFiles(t, input, map[string]string{"b.txt": "b"})
+	again, err = PlanUnify(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.True(plan.Changed(again))
+	os.Remove(filepath.Join(input, "b.txt"))
+
+	req.NoError(plan.Apply(nil))
+	after, err := PlanUnify(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.Empty(after.Operations)
+
+	content, err := ioutil.ReadFile(filepath.Join(destination, "changed.txt"))
+	req.NoError(err)
+	req.Equal("source", string(content))
+	_, err = os.Stat(filepath.Join(destination, "old"))
+	req.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(destination, "mixed", "foreign"))
+	req.NoError(err)
+	_, err = os.Stat(filepath.Join(destination, "foreign"))
+	req.NoError(err)
+
+	manifest, err = LoadManifest(destination)
+	req.NoError(err)
+	req.True(manifest.Owns("changed.txt"))
+	req.True(manifest.Owns("a" + sep + "new.txt"))
+	req.False(manifest.Owns("old" + sep + "file"))
+	req.False(manifest.Owns("foreign"))
+}
+
+func Test_PlanUnify_directoryReplacesFile(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_PlanUnify_directoryReplacesFile_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_PlanUnify_directoryReplacesFile_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	testutil.WriteFiles(t, input, map[string]string{"a/b/c": "new"})
+	testutil.WriteFiles(t, destination, map[string]string{"a": "old"})
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+
+	plan, err := PlanUnify(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	var ops []string
+	for _, op := range plan.Operations {
+		ops = append(ops, string(op.Kind)+" "+op.Path)
+	}
+	sep := string(filepath.Separator)
+	req.Equal([]string{"replace a" + sep, "mkdir " + filepath.Join("a", "b") + sep, "link " + filepath.Join("a", "b", "c")}, ops)
+
+	req.NoError(plan.Apply(nil))
+	content, err := ioutil.ReadFile(filepath.Join(destination, "a", "b", "c"))
+	req.NoError(err)
+	req.Equal("new", string(content))
+	after, err := PlanUnify(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.Empty(after.Operations)
+}
+
+func Test_PlanUpload_copy(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_PlanUpload_copy_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_PlanUpload_copy_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	testutil.WriteFiles(t, input, map[string]string{"file": "content"})
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+	opts := PlanOptions{LinkMode: LinkCopy}
+
+	plan, err := PlanUpload(input, destination, driveignore, opts)
+	req.NoError(err)
+	req.NoError(plan.Apply(nil))
+
+	// an unchanged copy is in sync
+	plan, err = PlanUpload(input, destination, driveignore, opts)
+	req.NoError(err)
+	req.Empty(plan.Operations)
+	req.Empty(plan.Conflicts)
+	clean, err := PlanClean(input, destination, opts)
+	req.NoError(err)
+	req.Empty(clean.Operations)
+
+	// a changed source replaces the untouched copy even without force
+	later := time.Now().Add(time.Hour)
+	req.NoError(os.Chtimes(filepath.Join(input, "file"), later, later))
+	plan, err = PlanUpload(input, destination, driveignore, opts)
+	req.NoError(err)
+	req.Len(plan.Operations, 1)
+	req.Equal(OpReplace, plan.Operations[0].Kind)
+	req.NoError(plan.Apply(nil))
+
+	// a copy modified in the destination is a conflict
+	testutil.WriteFiles(t, destination, map[string]string{"file": "modified"})
+	plan, err = PlanUpload(input, destination, driveignore, opts)
+	req.NoError(err)
+	req.Empty(plan.Operations)
+	req.Equal([]string{"file"}, plan.Conflicts)
+}
+
+func Test_PlanClean_ignored(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_PlanClean_ignored_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_PlanClean_ignored_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	testutil.WriteFiles(t, input, map[string]string{"a.log": "1", "build/x": "2", "build/y": "3", "keep": "4"})
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+	plan, err := PlanUpload(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.NoError(plan.Apply(nil))
+	// somebody else put a file into the drive folder
+	testutil.WriteFiles(t, destination, map[string]string{"build/theirs": "5"})
+
+	driveignore.base = testRules(t, "*.log\nbuild/\n", input)
+	plan, err = PlanClean(input, destination, PlanOptions{})
+	req.NoError(err)
+	req.Empty(plan.Operations)
+
+	plan, err = PlanClean(input, destination, PlanOptions{Ignored: driveignore})
+	req.NoError(err)
+	req.True(plan.CleanIgnored)
+	var removed []string
+	for _, op := range plan.Operations {
+		req.Equal(OpRemove, op.Kind)
+		removed = append(removed, op.Path)
+	}
+	req.Equal([]string{"a.log", filepath.Join("build", "x"), filepath.Join("build", "y")}, removed)
+}
+
+func Test_PlanClean_fileInInput(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_PlanClean_fileInInput_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_PlanClean_fileInInput_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	testutil.WriteFiles(t, input, map[string]string{"x/y": "1"})
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+	plan, err := PlanUpload(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.NoError(plan.Apply(nil))
+
+	// the directory became a file, what destination owns inside of it is gone from input
+	req.NoError(os.RemoveAll(filepath.Join(input, "x")))
+	testutil.WriteFiles(t, input, map[string]string{"x": "2"})
+	plan, err = PlanClean(input, destination, PlanOptions{})
+	req.NoError(err)
+	var removed []string
+	for _, op := range plan.Operations {
+		req.Equal(OpRemove, op.Kind)
+		removed = append(removed, op.Path)
+	}
+	req.Equal([]string{"x" + string(filepath.Separator), filepath.Join("x", "y")}, removed)
+}
+
+func Test_Plan_Apply_failures(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_Plan_Apply_failures_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_Plan_Apply_failures_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	testutil.WriteFiles(t, input, map[string]string{"a": "1", "b": "2", "c": "3"})
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+	plan, err := PlanUpload(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+
+	// the input file vanishes between planning and applying
+	req.NoError(os.Remove(filepath.Join(input, "b")))
+	err = plan.Apply(nil)
+	applyErr, ok := err.(*ApplyError)
+	req.True(ok, err)
+	req.Len(applyErr.Failures, 1)
+	req.Equal("b", applyErr.Failures[0].Operation.Path)
+	req.True(applyErr.Partial())
+	req.Equal("1 of 3 operations failed", applyErr.Summary())
+
+	// the other operations were performed and recorded anyway
+	for _, name := range []string{"a", "c"} {
+		_, err := os.Stat(filepath.Join(destination, name))
+		req.NoError(err)
+	}
+	manifest, err := LoadManifest(destination)
+	req.NoError(err)
+	req.True(manifest.Owns("a"))
+	req.False(manifest.Owns("b"))
+
+	// a failed replace leaves the destination file in place
+	req.NoError(os.Remove(filepath.Join(input, "a")))
+	testutil.WriteFiles(t, input, map[string]string{"a": "changed"})
+	plan, err = PlanUpload(input, destination, driveignore, PlanOptions{Force: true})
+	req.NoError(err)
+	req.Len(plan.Operations, 1)
+	req.Equal(OpReplace, plan.Operations[0].Kind)
+	req.NoError(os.Remove(filepath.Join(input, "a")))
+	err = plan.Apply(nil)
+	_, ok = err.(*ApplyError)
+	req.True(ok, err)
+	content, err := ioutil.ReadFile(filepath.Join(destination, "a"))
+	req.NoError(err)
+	req.Equal("1", string(content))
+	testutil.WriteFiles(t, input, map[string]string{"a": "1"})
+
+	// directories are only removed once empty, entries put there after planning stay
+	testutil.WriteFiles(t, input, map[string]string{"dir/x": "x"})
+	plan, err = PlanUpload(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.NoError(plan.Apply(nil))
+	req.NoError(os.RemoveAll(filepath.Join(input, "dir")))
+	plan, err = PlanClean(input, destination, PlanOptions{})
+	req.NoError(err)
+	testutil.WriteFiles(t, destination, map[string]string{"dir/foreign": "put there by someone else"})
+	err = plan.Apply(nil)
+	applyErr, ok = err.(*ApplyError)
+	req.True(ok, err)
+	req.Len(applyErr.Failures, 1)
+	req.Equal("dir"+string(filepath.Separator), applyErr.Failures[0].Operation.Path)
+	_, err = os.Stat(filepath.Join(destination, "dir", "foreign"))
+	req.NoError(err)
+	_, err = os.Stat(filepath.Join(destination, "dir", "x"))
+	req.True(os.IsNotExist(err))
+}
+
+func Test_Plan_Apply_replaceDirectory(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_Plan_Apply_replaceDirectory_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_Plan_Apply_replaceDirectory_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	sep := string(filepath.Separator)
+	testutil.WriteFiles(t, input, map[string]string{"owned": "file", "mixed": "file"})
+	testutil.WriteFiles(t, destination, map[string]string{"owned/x": "", "mixed/x": "", "mixed/foreign": "put there by someone else"})
+	manifest, err := LoadManifest(destination)
+	req.NoError(err)
+	for _, p := range []string{"owned" + sep, filepath.Join("owned", "x"), "mixed" + sep, filepath.Join("mixed", "x")} {
+		manifest.Record(p, ManifestEntry{})
+	}
+	req.NoError(manifest.Save())
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+
+	// without a trash only directories holding nothing but entries driveignore created are replaced
+	plan, err := PlanUnify(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	err = plan.Apply(nil)
+	applyErr, ok := err.(*ApplyError)
+	req.True(ok, err)
+	req.Len(applyErr.Failures, 1)
+	req.Equal("mixed", applyErr.Failures[0].Operation.Path)
+	content, err := ioutil.ReadFile(filepath.Join(destination, "mixed", "foreign"))
+	req.NoError(err)
+	req.Equal("put there by someone else", string(content))
+	content, err = ioutil.ReadFile(filepath.Join(destination, "owned"))
+	req.NoError(err)
+	req.Equal("file", string(content))
+}
+
+func Test_PlanPaths(t *testing.T) {
+	sep := string(filepath.Separator)
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, input string)
+		paths   []string
+		want    []Operation
+		removed []string
+	}{
+		{
+			name: "created entries",
+			change: func(t *testing.T, input string) {
+				testutil.WriteFiles(t, input, map[string]string{"new.txt": "n", "new/f.txt": "f"})
+			},
+			paths: []string{"new", filepath.Join("new", "f.txt"), "new.txt"},
+			want: []Operation{
+				{Kind: OpMkdir, Path: "new" + sep},
+				{Kind: OpLink, Path: filepath.Join("new", "f.txt")},
+				{Kind: OpLink, Path: "new.txt"},
+			},
+		},
+		{
+			name: "modified file",
+			change: func(t *testing.T, input string) {
+				// editors save by writing a new file in place of the old one
+				require.NoError(t, os.Remove(filepath.Join(input, "g.txt")))
+				testutil.WriteFiles(t, input, map[string]string{"g.txt": "changed"})
+			},
+			paths: []string{"g.txt"},
+			want:  []Operation{{Kind: OpReplace, Path: "g.txt"}},
+		},
+		{
+			name:    "deleted file",
+			change:  func(t *testing.T, input string) { require.NoError(t, os.Remove(filepath.Join(input, "g.txt"))) },
+			paths:   []string{"g.txt"},
+			want:    []Operation{{Kind: OpRemove, Path: "g.txt"}},
+			removed: []string{"g.txt"},
+		},
+		{
+			name:    "deleted directory",
+			change:  func(t *testing.T, input string) { require.NoError(t, os.RemoveAll(filepath.Join(input, "dir"))) },
+			paths:   []string{"dir", filepath.Join("dir", "f.txt")},
+			want:    []Operation{{Kind: OpRemove, Path: "dir" + sep}, {Kind: OpRemove, Path: filepath.Join("dir", "f.txt")}},
+			removed: []string{"dir"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			input, err := ioutil.TempDir("", "driveignore_Test_PlanPaths_input")
+			req.NoError(err)
+			defer os.RemoveAll(input)
+			destination, err := ioutil.TempDir("", "driveignore_Test_PlanPaths_destination")
+			req.NoError(err)
+			defer os.RemoveAll(destination)
+
+			testutil.WriteFiles(t, input, map[string]string{"g.txt": "g", "dir/f.txt": "f"})
+			driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+			plan, err := PlanUnify(input, destination, driveignore, PlanOptions{})
+			req.NoError(err)
+			req.NoError(plan.Apply(nil))
+
+			tt.change(t, input)
+			plan, err = PlanPaths(input, destination, driveignore, tt.paths, PlanOptions{})
+			req.NoError(err)
+			var got []Operation
+			for _, op := range plan.Operations {
+				got = append(got, Operation{Kind: op.Kind, Path: op.Path})
+			}
+			req.Equal(tt.want, got)
+
+			req.NoError(plan.Apply(nil))
+			again, err := PlanPaths(input, destination, driveignore, tt.paths, PlanOptions{})
+			req.NoError(err)
+			req.Empty(again.Operations)
+			for _, name := range tt.removed {
+				_, err := os.Lstat(filepath.Join(destination, name))
+				req.True(os.IsNotExist(err), name)
+			}
+		})
+	}
+}
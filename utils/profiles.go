@@ -0,0 +1,138 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Profile is a named input directory mirrored into a drive folder
+type Profile struct {
+	Name         string   `json:"name"`
+	Input        string   `json:"input"`
+	Destination  string   `json:"destination"`
+	MergeIgnores bool     `json:"mergeIgnores,omitempty"`
+	UseGitignore bool     `json:"useGitignore,omitempty"`
+	Git          GitMode  `json:"git,omitempty"`
+	LinkMode     LinkMode `json:"linkMode,omitempty"`
+	// Symlinks is the symlink policy, SymlinksOutside allows following links out of the input directory
+	Symlinks        SymlinkPolicy `json:"symlinks,omitempty"`
+	SymlinksOutside bool          `json:"symlinksOutside,omitempty"`
+}
+
+// Flags returns the options the profile pins as values of the command line flags of unify.
+// The ones it leaves out come from the project settings or the defaults
+func (p Profile) Flags() map[string]string {
+	flags := map[string]string{}
+	if p.MergeIgnores {
+		flags["merge-ignores"] = "true"
+	}
+	if p.UseGitignore {
+		flags["use-gitignore"] = "true"
+	}
+	if p.Git != GitAll {
+		flags["git"] = string(p.Git)
+	}
+	if p.LinkMode != "" {
+		flags["link-mode"] = string(p.LinkMode)
+	}
+	if p.Symlinks != "" {
+		flags["symlinks"] = string(p.Symlinks)
+	}
+	if p.SymlinksOutside {
+		flags["symlinks-outside"] = "true"
+	}
+	return flags
+}
+
+// Profiles is the registry of profiles kept next to .global_driveignore
+type Profiles struct {
+	path     string
+	Profiles []Profile `json:"profiles"`
+}
+
+// ProfilesPath returns absolute path to the profiles registry
+func ProfilesPath() (string, error) {
+	global, err := GlobalDriveignorePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(global), "profiles.json"), nil
+}
+
+// LoadProfiles reads the registry at path, a missing one is empty
+func LoadProfiles(path string) (*Profiles, error) {
+	ps := &Profiles{path: path, Profiles: []Profile{}}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ps, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, ps); err != nil {
+		return nil, configErrorf("Invalid profiles file '%s': %v", path, err)
+	}
+	return ps, nil
+}
+
+// Save writes the registry back
+func (ps *Profiles) Save() error {
+	data, err := json.MarshalIndent(ps, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ps.path), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ps.path, append(data, '\n'), 0644)
+}
+
+// Get returns the profile with the given name or nil if there is none
+func (ps *Profiles) Get(name string) *Profile {
+	for i := range ps.Profiles {
+		if ps.Profiles[i].Name == name {
+			return &ps.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// Add registers a new profile, names are unique
+func (ps *Profiles) Add(profile Profile) error {
+	if ps.Get(profile.Name) != nil {
+		return configErrorf("Profile '%s' already exists", profile.Name)
+	}
+	ps.Profiles = append(ps.Profiles, profile)
+	sort.SliceStable(ps.Profiles, func(i, j int) bool {
+		return ps.Profiles[i].Name < ps.Profiles[j].Name
+	})
+	return nil
+}
+
+// Remove unregisters the profile with the given name
+func (ps *Profiles) Remove(name string) error {
+	for i := range ps.Profiles {
+		if ps.Profiles[i].Name == name {
+			ps.Profiles = append(ps.Profiles[:i], ps.Profiles[i+1:]...)
+			return nil
+		}
+	}
+	return configErrorf("Profile '%s' doesnt exist", name)
+}
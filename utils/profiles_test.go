@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Profiles(t *testing.T) {
+	req := require.New(t)
+	dir, err := ioutil.TempDir("", "driveignore_Test_Profiles")
+	req.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "driveignore", "profiles.json")
+
+	profiles, err := LoadProfiles(path)
+	req.NoError(err)
+	req.Empty(profiles.Profiles)
+
+	req.NoError(profiles.Add(Profile{Name: "work", Input: "/work", Destination: "/drive/work", LinkMode: LinkCopy}))
+	req.NoError(profiles.Add(Profile{Name: "notes", Input: "/notes", Destination: "/drive/notes", MergeIgnores: true}))
+	req.Error(profiles.Add(Profile{Name: "work"}))
+	req.NoError(profiles.Save())
+
+	profiles, err = LoadProfiles(path)
+	req.NoError(err)
+	req.Equal([]Profile{
+		{Name: "notes", Input: "/notes", Destination: "/drive/notes", MergeIgnores: true},
+		{Name: "work", Input: "/work", Destination: "/drive/work", LinkMode: LinkCopy},
+	}, profiles.Profiles)
+	req.Equal("/work", profiles.Get("work").Input)
+	req.Nil(profiles.Get("games"))
+
+	req.Equal(map[string]string{"link-mode": "copy"}, profiles.Get("work").Flags())
+	req.Equal(map[string]string{"merge-ignores": "true"}, profiles.Get("notes").Flags())
+
+	req.NoError(profiles.Remove("notes"))
+	req.Error(profiles.Remove("notes"))
+	req.Len(profiles.Profiles, 1)
+}
@@ -0,0 +1,101 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+
+	gitignore "github.com/monochromegane/go-gitignore"
+)
+
+// RepairPolicy decides what happens to a file whose link got broken and whose content diverged
+type RepairPolicy string
+
+const (
+	// RepairNone only reports diverged files
+	RepairNone RepairPolicy = "none"
+	// RepairSource links the input file again, changes made in the destination are lost
+	RepairSource RepairPolicy = "source"
+	// RepairNewer keeps the side that was modified last
+	RepairNewer RepairPolicy = "newer"
+)
+
+// ParseRepairPolicy validates the name of a repair policy
+func ParseRepairPolicy(policy string) (RepairPolicy, error) {
+	switch RepairPolicy(policy) {
+	case RepairNone, RepairSource, RepairNewer:
+		return RepairPolicy(policy), nil
+	}
+	return "", configErrorf("Invalid repair policy '%s', should be one of: none, source, newer", policy)
+}
+
+// PlanRepair computes the operations that link again the files existing on both sides
+// which no longer share their content, for example after an editor saved a new file over the old one.
+// With checkContent files with equal content are always linked again, the other ones are handled
+// according to prefer. Diverged files that are left alone end up in the plan conflicts
+func PlanRepair(input string, destination string, driveignore gitignore.IgnoreMatcher, prefer RepairPolicy, checkContent bool, opts PlanOptions) (*Plan, error) {
+	plan, err := newPlan(input, destination, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = IgnoreWalker(input, driveignore, opts.WalkOptions, opts.Skipped, func(currPath string, info os.FileInfo, relativePath string) error {
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		goalStat, err := plan.goals.stat(relativePath)
+		if os.IsNotExist(err) || (err == nil && !goalStat.Mode().IsRegular()) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if plan.manifest.InSync(relativePath, info, goalStat) {
+			return nil
+		}
+
+		if checkContent {
+			same, err := SameContent(currPath, filepath.Join(destination, relativePath))
+			if err != nil {
+				return err
+			}
+			if same {
+				plan.add(OpReplace, relativePath, info, goalStat)
+				return nil
+			}
+		}
+
+		switch {
+		case prefer == RepairSource:
+			plan.add(OpReplace, relativePath, info, goalStat)
+		case prefer == RepairNewer && goalStat.ModTime().After(info.ModTime()):
+			plan.add(OpRestore, relativePath, info, goalStat)
+		case prefer == RepairNewer:
+			plan.add(OpReplace, relativePath, info, goalStat)
+		default:
+			plan.Conflicts = append(plan.Conflicts, relativePath)
+		}
+		return nil
+	})
+	return plan, err
+}
+
+// PlanAdopt computes the operations that replace the destination files having byte for byte
+// the same content as their input file with links to it, for example after the drive folder
+// was filled by copying or restored from a backup. Files with a different content end up
+// in the plan conflicts
+func PlanAdopt(input string, destination string, driveignore gitignore.IgnoreMatcher, opts PlanOptions) (*Plan, error) {
+	return PlanRepair(input, destination, driveignore, RepairNone, true, opts)
+}
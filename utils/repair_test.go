@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PlanRepair(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_PlanRepair_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_PlanRepair_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	files := map[string]string{"linked": "a", "same": "b", "older": "c", "newer": "d"}
+	testutil.WriteFiles(t, input, files)
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+	plan, err := PlanUpload(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.NoError(plan.Apply(nil))
+
+	// break every link but the first one, then edit the drive side
+	for name, content := range files {
+		if name == "linked" {
+			continue
+		}
+		req.NoError(os.Remove(filepath.Join(destination, name)))
+		testutil.WriteFiles(t, destination, map[string]string{name: content})
+	}
+	testutil.WriteFiles(t, destination, map[string]string{"older": "edited", "newer": "edited"})
+	earlier, later := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	req.NoError(os.Chtimes(filepath.Join(destination, "older"), earlier, earlier))
+	req.NoError(os.Chtimes(filepath.Join(destination, "newer"), later, later))
+
+	tests := []struct {
+		prefer       RepairPolicy
+		checkContent bool
+		operations   []Operation
+		conflicts    []string
+	}{
+		{RepairNone, true, []Operation{{Kind: OpReplace, Path: "same"}}, []string{"newer", "older"}},
+		{RepairNone, false, nil, []string{"newer", "older", "same"}},
+		{RepairSource, true, []Operation{{Kind: OpReplace, Path: "newer"}, {Kind: OpReplace, Path: "older"}, {Kind: OpReplace, Path: "same"}}, nil},
+		{RepairNewer, true, []Operation{{Kind: OpRestore, Path: "newer"}, {Kind: OpReplace, Path: "older"}, {Kind: OpReplace, Path: "same"}}, nil},
+	}
+	for _, test := range tests {
+		plan, err := PlanRepair(input, destination, driveignore, test.prefer, test.checkContent, PlanOptions{})
+		req.NoError(err)
+		var operations []Operation
+		for _, op := range plan.Operations {
+			operations = append(operations, Operation{Kind: op.Kind, Path: op.Path})
+		}
+		req.Equal(test.operations, operations, test.prefer)
+		req.Equal(test.conflicts, plan.Conflicts, test.prefer)
+	}
+
+	// the newer drive file ends up on both sides
+	plan, err = PlanRepair(input, destination, driveignore, RepairNewer, true, PlanOptions{})
+	req.NoError(err)
+	req.NoError(plan.Apply(nil))
+	content, err := ioutil.ReadFile(filepath.Join(input, "newer"))
+	req.NoError(err)
+	req.Equal("edited", string(content))
+	content, err = ioutil.ReadFile(filepath.Join(destination, "older"))
+	req.NoError(err)
+	req.Equal("c", string(content))
+
+	plan, err = PlanRepair(input, destination, driveignore, RepairNone, false, PlanOptions{})
+	req.NoError(err)
+	req.Empty(plan.Operations)
+	req.Empty(plan.Conflicts)
+}
+
+func Test_PlanAdopt(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_PlanAdopt_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_PlanAdopt_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	// the drive folder was filled by copying, without driveignore
+	testutil.WriteFiles(t, input, map[string]string{"copied": "a", "sub/copied": "b", "edited": "c", "new": "d"})
+	testutil.WriteFiles(t, destination, map[string]string{"copied": "a", "sub/copied": "b", "edited": "e", "other": "f"})
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+
+	plan, err := PlanAdopt(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	var operations []Operation
+	for _, op := range plan.Operations {
+		operations = append(operations, Operation{Kind: op.Kind, Path: op.Path})
+	}
+	req.Equal([]Operation{{Kind: OpReplace, Path: "copied"}, {Kind: OpReplace, Path: filepath.Join("sub", "copied")}}, operations)
+	req.Equal([]string{"edited"}, plan.Conflicts)
+	req.NoError(plan.Apply(nil))
+
+	for _, name := range []string{"copied", filepath.Join("sub", "copied")} {
+		info1, err := os.Stat(filepath.Join(input, name))
+		req.NoError(err)
+		info2, err := os.Stat(filepath.Join(destination, name))
+		req.NoError(err)
+		req.True(os.SameFile(info1, info2), name)
+	}
+
+	// adopted files are in sync, so an upload leaves them alone
+	plan, err = PlanUpload(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.Equal([]string{"edited"}, plan.Conflicts)
+	for _, op := range plan.Operations {
+		req.NotContains([]string{"copied", filepath.Join("sub", "copied")}, op.Path)
+	}
+}
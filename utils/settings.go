@@ -0,0 +1,87 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SettingsFileName is the name of the project settings file in the input directory
+const SettingsFileName = ".driveignore.toml"
+
+// Settings pin the options of a project so that they do not have to be passed on every call
+type Settings struct {
+	// Destination is the drive sync folder, relative paths are relative to the input directory
+	Destination  string `toml:"destination"`
+	MergeIgnores *bool  `toml:"merge_ignores"`
+	UseGitignore *bool  `toml:"use_gitignore"`
+	Git          string `toml:"git"`
+	Force        *bool  `toml:"force"`
+	LinkMode     string `toml:"link_mode"`
+}
+
+// LoadSettings reads the settings file of the input directory, a missing one is empty
+func LoadSettings(input string) (*Settings, error) {
+	settings := &Settings{}
+	path := filepath.Join(input, SettingsFileName)
+	meta, err := toml.DecodeFile(path, settings)
+	if os.IsNotExist(err) {
+		return settings, nil
+	} else if _, ok := err.(*os.PathError); ok {
+		return nil, err
+	} else if err != nil {
+		return nil, configErrorf("Invalid %s: %v", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, configErrorf("Unknown setting '%s' in %s", undecoded[0], path)
+	}
+
+	if strings.HasPrefix(settings.Destination, "~"+string(filepath.Separator)) || settings.Destination == "~" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		settings.Destination = filepath.Join(home, settings.Destination[1:])
+	} else if settings.Destination != "" && !filepath.IsAbs(settings.Destination) {
+		settings.Destination = filepath.Join(input, settings.Destination)
+	}
+	return settings, nil
+}
+
+// Flags returns the settings as values of the command line flags they pin
+func (s *Settings) Flags() map[string]string {
+	flags := map[string]string{}
+	if s.MergeIgnores != nil {
+		flags["merge-ignores"] = strconv.FormatBool(*s.MergeIgnores)
+	}
+	if s.UseGitignore != nil {
+		flags["use-gitignore"] = strconv.FormatBool(*s.UseGitignore)
+	}
+	if s.Git != "" {
+		flags["git"] = s.Git
+	}
+	if s.Force != nil {
+		flags["force"] = strconv.FormatBool(*s.Force)
+	}
+	if s.LinkMode != "" {
+		flags["link-mode"] = s.LinkMode
+	}
+	return flags
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadSettings(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_LoadSettings")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+
+	settings, err := LoadSettings(input)
+	req.NoError(err)
+	req.Equal(&Settings{}, settings)
+	req.Empty(settings.Flags())
+
+	testutil.WriteFiles(t, input, map[string]string{
+		SettingsFileName: "destination = \"../drive\"\nmerge_ignores = true\nuse_gitignore = true\ngit = \"tracked\"\nforce = false\nlink_mode = \"auto\"\n",
+	})
+	settings, err = LoadSettings(input)
+	req.NoError(err)
+	req.Equal(filepath.Join(filepath.Dir(input), "drive"), settings.Destination)
+	req.Equal(map[string]string{"merge-ignores": "true", "use-gitignore": "true", "git": "tracked", "force": "false", "link-mode": "auto"}, settings.Flags())
+
+	testutil.WriteFiles(t, input, map[string]string{SettingsFileName: "link-mode = \"auto\"\n"})
+	_, err = LoadSettings(input)
+	req.Error(err)
+}
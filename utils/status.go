@@ -0,0 +1,157 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// SyncState is the state of a path compared between the input and the destination
+type SyncState int
+
+const (
+	// StateInSync entries share their content
+	StateInSync SyncState = iota
+	// StateMissing entries exist only in the input
+	StateMissing
+	// StateExtra entries exist only in the destination
+	StateExtra
+	// StateBroken files are no longer linked but still have the same content
+	StateBroken
+	// StateDiverged files are no longer linked and their content differs
+	StateDiverged
+	// StateIgnored entries exist in the destination but are ignored by the .driveignores
+	StateIgnored
+)
+
+// SyncStates lists every state in the order they are reported
+var SyncStates = []SyncState{StateInSync, StateMissing, StateExtra, StateBroken, StateDiverged, StateIgnored}
+
+func (s SyncState) String() string {
+	switch s {
+	case StateInSync:
+		return "in sync"
+	case StateMissing:
+		return "missing from drive folder"
+	case StateExtra:
+		return "extra in drive folder"
+	case StateBroken:
+		return "link broken, content equal"
+	case StateDiverged:
+		return "link broken, content diverged"
+	case StateIgnored:
+		return "newly ignored"
+	}
+	return "unknown"
+}
+
+// Code is the single letter of the state used in porcelain output
+func (s SyncState) Code() string {
+	return [...]string{"=", "M", "E", "B", "D", "I"}[s]
+}
+
+// StatusEntry is a path (relative to both directories) and its state
+type StatusEntry struct {
+	Path  string
+	State SyncState
+}
+
+// Status sorts every entry of the input and the destination into a sync state.
+// Files that are no longer linked are compared like diff does, by size and then a hash of
+// their content, with content they are compared byte for byte instead. The entries are sorted by path
+func Status(input string, destination string, driveignore *Ignorer, opts WalkOptions, content bool) ([]StatusEntry, error) {
+	manifest, err := LoadManifest(destination)
+	if err != nil {
+		return nil, err
+	}
+	var entries []StatusEntry
+	inputs, goals := newLookup(input, opts), newLookup(destination, WalkOptions{})
+
+	err = IgnoreWalker(input, driveignore, opts, nil, func(currPath string, info os.FileInfo, relativePath string) error {
+		state, err := pairState(manifest, goals, currPath, info, relativePath, content)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, StatusEntry{relativePath, state})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = Walker(destination, WalkOptions{Jobs: opts.Jobs}, func(goalPath string, info os.FileInfo, relativePath string) error {
+		if relativePath == ManifestFileName {
+			return nil
+		}
+		currPath := filepath.Join(input, relativePath)
+		if _, err := inputs.stat(relativePath); os.IsNotExist(err) {
+			entries = append(entries, StatusEntry{relativePath, StateExtra})
+		} else if notExist(err) {
+			// the input has a file in place of one of its parents
+			entries = append(entries, StatusEntry{relativePath, StateDiverged})
+		} else if err != nil {
+			return err
+		} else if d := driveignore.Explain(currPath, info.IsDir()); d != nil && d.Ignored {
+			entries = append(entries, StatusEntry{relativePath, StateIgnored})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// pairState compares a not ignored input entry with the destination
+func pairState(manifest *Manifest, goals *lookup, currPath string, info os.FileInfo, relativePath string, content bool) (SyncState, error) {
+	goalStat, err := goals.stat(relativePath)
+	if os.IsNotExist(err) {
+		return StateMissing, nil
+	} else if notExist(err) {
+		// the destination has a file in place of one of its parents
+		return StateDiverged, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case info.IsDir() != goalStat.IsDir():
+		return StateDiverged, nil
+	case info.IsDir() || manifest.InSync(relativePath, info, goalStat):
+		return StateInSync, nil
+	case !info.Mode().IsRegular() || !goalStat.Mode().IsRegular():
+		return StateDiverged, nil
+	}
+	goalPath := filepath.Join(goals.root, relativePath)
+	var same bool
+	if content {
+		same, err = SameContent(currPath, goalPath)
+	} else {
+		same, err = QuickSameContent(currPath, info, goalPath, goalStat)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if same {
+		return StateBroken, nil
+	}
+	return StateDiverged, nil
+}
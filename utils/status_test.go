@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Status(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_Status_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_Status_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+
+	testutil.WriteFiles(t, input, map[string]string{
+		"sync":      "1",
+		"broken":    "2",
+		"diverged":  "3",
+		"touched":   "5",
+		"stamped":   "6",
+		"later.log": "4",
+	})
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+	plan, err := PlanUpload(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.NoError(plan.Apply(nil))
+
+	testutil.WriteFiles(t, input, map[string]string{"missing": ""})
+	for name, content := range map[string]string{"broken": "2", "diverged": "33", "touched": "5", "stamped": "7", "extra": ""} {
+		os.Remove(filepath.Join(destination, name))
+		testutil.WriteFiles(t, destination, map[string]string{name: content})
+	}
+	// the modification time says nothing: the stamped copy keeps it while its content differs,
+	// the touched one got a new one while its content is the same
+	info, err := os.Stat(filepath.Join(input, "stamped"))
+	req.NoError(err)
+	req.NoError(os.Chtimes(filepath.Join(destination, "stamped"), info.ModTime(), info.ModTime()))
+	later := info.ModTime().Add(time.Hour)
+	req.NoError(os.Chtimes(filepath.Join(destination, "touched"), later, later))
+	driveignore.base = testRules(t, "*.log\n", input)
+
+	for _, content := range []bool{false, true} {
+		entries, err := Status(input, destination, driveignore, WalkOptions{}, content)
+		req.NoError(err)
+		req.Equal([]StatusEntry{
+			{"broken", StateBroken},
+			{"diverged", StateDiverged},
+			{"extra", StateExtra},
+			{"later.log", StateIgnored},
+			{"missing", StateMissing},
+			{"stamped", StateDiverged},
+			{"sync", StateInSync},
+			{"touched", StateBroken},
+		}, entries, content)
+	}
+}
+
+func Test_Status_fileAndDirectory(t *testing.T) {
+	req := require.New(t)
+	root, err := ioutil.TempDir("", "driveignore_Test_Status_fileAndDirectory")
+	req.NoError(err)
+	defer os.RemoveAll(root)
+	input, destination := filepath.Join(root, "input"), filepath.Join(root, "destination")
+
+	// a directory on one side is a file on the other, in both directions
+	testutil.WriteFiles(t, input, map[string]string{"a/b": "", "c": ""})
+	testutil.WriteFiles(t, destination, map[string]string{"a": "", "c/d": ""})
+
+	sep := string(filepath.Separator)
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+	entries, err := Status(input, destination, driveignore, WalkOptions{}, false)
+	req.NoError(err)
+	req.Equal([]StatusEntry{
+		{"a" + sep, StateDiverged},
+		{filepath.Join("a", "b"), StateDiverged},
+		{"c", StateDiverged},
+		{filepath.Join("c", "d"), StateDiverged},
+	}, entries)
+}
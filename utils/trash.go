@@ -0,0 +1,359 @@
+// Copyright © 2019 Marcin Wojnarowski xmarcinmarcin@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trashEntryFileName describes the removed paths of a trash entry
+const trashEntryFileName = "entry.json"
+
+// TrashPath returns absolute path to the trash, it is kept next to .global_driveignore
+// so that it is never synced along with the drive folders
+func TrashPath() (string, error) {
+	global, err := GlobalDriveignorePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(global), "trash"), nil
+}
+
+// TrashEntry holds the entries removed from a drive folder by a single run
+type TrashEntry struct {
+	ID          string    `json:"-"`
+	Destination string    `json:"destination"`
+	Time        time.Time `json:"time"`
+	Paths       []string  `json:"paths"`
+	// Manifest keeps the manifest entries of the paths driveignore owned so that they are recorded again once restored
+	Manifest map[string]ManifestEntry `json:"manifest"`
+
+	dir string
+	mu  sync.Mutex
+}
+
+// Trash is the directory removed entries are moved to, every run gets a dated directory
+type Trash struct {
+	Path string
+	// Warn (if not nil) is called for every malformed entry skipped by Entries
+	Warn func(error)
+}
+
+// Entries lists the entries of the trash from the oldest one, malformed entries are skipped
+func (t Trash) Entries() ([]*TrashEntry, error) {
+	infos, err := ioutil.ReadDir(t.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []*TrashEntry
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		entry, err := t.entry(info.Name())
+		if err != nil {
+			if t.Warn != nil {
+				t.Warn(fmt.Errorf("Skipped trash entry: %v", err))
+			}
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, nil
+}
+
+func (t Trash) entry(id string) (*TrashEntry, error) {
+	entry := &TrashEntry{ID: id, dir: filepath.Join(t.Path, id)}
+	data, err := ioutil.ReadFile(filepath.Join(entry.dir, trashEntryFileName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Trash entry '%s' doesnt exist", id)
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("Invalid trash entry '%s': %v", id, err)
+	}
+	return entry, nil
+}
+
+// create makes a new entry for the removals from destination
+func (t Trash) create(destination string) (*TrashEntry, error) {
+	if err := os.MkdirAll(t.Path, os.ModePerm); err != nil {
+		return nil, err
+	}
+	destination, err := filepath.Abs(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	id := now.Format("20060102-150405")
+	for i := 1; ; i++ {
+		err := os.Mkdir(filepath.Join(t.Path, id), os.ModePerm)
+		if err == nil {
+			break
+		} else if !os.IsExist(err) {
+			return nil, err
+		}
+		id = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), i)
+	}
+
+	entry := &TrashEntry{ID: id, Destination: destination, Time: now, Paths: []string{}, Manifest: map[string]ManifestEntry{}, dir: filepath.Join(t.Path, id)}
+	return entry, entry.save()
+}
+
+// Restore moves the given paths (all of them if none are given) back into the drive folder,
+// directories along with their entries, and records them in its manifest again.
+// Entries that would overwrite an existing file are left in the trash, the rest is still
+// restored and the error lists the ones left
+func (t Trash) Restore(id string, paths []string) (restored []string, err error) {
+	entry, err := t.entry(id)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := LoadManifest(entry.Destination)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if len(restored) == 0 {
+			return
+		}
+		if saveErr := manifest.Save(); err == nil {
+			err = saveErr
+		}
+	}()
+	if len(paths) == 0 {
+		paths = append(paths, entry.Paths...)
+	}
+
+	sep := string(filepath.Separator)
+	selected := map[string]bool{}
+	for _, path := range paths {
+		found := false
+		for _, p := range entry.Paths {
+			if strings.TrimSuffix(p, sep) == strings.TrimSuffix(filepath.Clean(path), sep) {
+				found = true
+				selected[p] = true
+			} else if strings.HasPrefix(p, strings.TrimSuffix(filepath.Clean(path), sep)+sep) {
+				selected[p] = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Path '%s' isnt in trash entry '%s'", path, id)
+		}
+	}
+	paths = paths[:0]
+	for path := range selected {
+		paths = append(paths, path)
+	}
+	// parent directories go first
+	sort.Strings(paths)
+
+	var conflicts []string
+	for _, path := range paths {
+		index := -1
+		for i, p := range entry.Paths {
+			if p == path {
+				index = i
+			}
+		}
+
+		goalPath := filepath.Join(entry.Destination, path)
+		if entry.holds(path) {
+			// entries of the directory are restored on their own
+			if err := os.MkdirAll(goalPath, os.ModePerm); err != nil {
+				return restored, err
+			}
+		} else {
+			if _, err := os.Lstat(goalPath); err == nil {
+				conflicts = append(conflicts, "'"+path+"'")
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(goalPath), os.ModePerm); err != nil {
+				return restored, err
+			}
+			if err := move(filepath.Join(entry.dir, "files", path), goalPath); err != nil {
+				return restored, err
+			}
+		}
+		// entries written before manifest entries were kept only hold removed entries driveignore owned
+		if recorded, ok := entry.Manifest[path]; ok || entry.Manifest == nil {
+			manifest.Record(path, recorded)
+		}
+		entry.Paths = append(entry.Paths[:index], entry.Paths[index+1:]...)
+		restored = append(restored, path)
+		if err := entry.save(); err != nil {
+			return restored, err
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return restored, fmt.Errorf("Cannot restore %s, already existing in the drive folder, left in the trash", strings.Join(conflicts, ", "))
+	}
+	if len(entry.Paths) == 0 {
+		return restored, os.RemoveAll(entry.dir)
+	}
+	return restored, nil
+}
+
+// Purge permanently deletes the entries with the given ids (all of them if none are given)
+// that are older than olderThan
+func (t Trash) Purge(ids []string, olderThan time.Duration) ([]*TrashEntry, error) {
+	var entries []*TrashEntry
+	if len(ids) == 0 {
+		all, err := t.Entries()
+		if err != nil {
+			return nil, err
+		}
+		entries = all
+	}
+	for _, id := range ids {
+		entry, err := t.entry(id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	var purged []*TrashEntry
+	for _, entry := range entries {
+		if time.Since(entry.Time) < olderThan {
+			continue
+		}
+		if err := os.RemoveAll(entry.dir); err != nil {
+			return purged, err
+		}
+		purged = append(purged, entry)
+	}
+	return purged, nil
+}
+
+// add moves the entry at relativePath of the drive folder into the trash. With isDir the directory
+// has to be empty, it is recreated in the trash and removed, otherwise the entry is moved whole
+func (e *TrashEntry) add(relativePath string, isDir bool) error {
+	trashPath := filepath.Join(e.dir, "files", relativePath)
+	if isDir {
+		if err := os.MkdirAll(trashPath, os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(e.Destination, relativePath)); err != nil {
+			return err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(trashPath), os.ModePerm); err != nil {
+			return err
+		}
+		if err := move(filepath.Join(e.Destination, relativePath), trashPath); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Paths = append(e.Paths, relativePath)
+	return nil
+}
+
+// remember keeps the manifest entry of a path moved into the trash
+func (e *TrashEntry) remember(relativePath string, recorded ManifestEntry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Manifest[relativePath] = recorded
+}
+
+// holds reports whether other paths of the entry are inside of the directory at path
+func (e *TrashEntry) holds(path string) bool {
+	sep := string(filepath.Separator)
+	if !strings.HasSuffix(path, sep) {
+		return false
+	}
+	for _, p := range e.Paths {
+		if p != path && strings.HasPrefix(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *TrashEntry) save() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sort.Strings(e.Paths)
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(e.dir, trashEntryFileName), append(data, '\n'), 0644)
+}
+
+// move renames path to newPath, across file systems the tree is copied and removed
+func move(path string, newPath string) error {
+	err := os.Rename(path, newPath)
+	if err == nil || os.IsNotExist(err) {
+		return err
+	}
+	if err := copyTree(path, newPath); err != nil {
+		os.RemoveAll(newPath)
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+func copyTree(path string, newPath string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, newPath)
+	case !info.IsDir():
+		_, err := Link(path, newPath, LinkCopy)
+		return err
+	}
+
+	if err := os.MkdirAll(newPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, child := range infos {
+		if err := copyTree(filepath.Join(path, child.Name()), filepath.Join(newPath, child.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shilangyu/driveignore/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Trash(t *testing.T) {
+	req := require.New(t)
+	input, err := ioutil.TempDir("", "driveignore_Test_Trash_input")
+	req.NoError(err)
+	defer os.RemoveAll(input)
+	destination, err := ioutil.TempDir("", "driveignore_Test_Trash_destination")
+	req.NoError(err)
+	defer os.RemoveAll(destination)
+	trashPath, err := ioutil.TempDir("", "driveignore_Test_Trash_trash")
+	req.NoError(err)
+	defer os.RemoveAll(trashPath)
+	var warnings []error
+	trash := Trash{Path: trashPath, Warn: func(err error) { warnings = append(warnings, err) }}
+
+	testutil.WriteFiles(t, input, map[string]string{"kept": "a", "file": "b", "dir/nested": "c"})
+	driveignore := &Ignorer{root: input, nested: map[string]rules{}}
+	plan, err := PlanUpload(input, destination, driveignore, PlanOptions{})
+	req.NoError(err)
+	req.NoError(plan.Apply(nil))
+
+	// nothing removed, nothing trashed
+	plan, err = PlanClean(input, destination, PlanOptions{})
+	req.NoError(err)
+	plan.Trash = trashPath
+	req.NoError(plan.Apply(nil))
+	req.Nil(plan.Trashed())
+
+	req.NoError(os.Remove(filepath.Join(input, "file")))
+	req.NoError(os.RemoveAll(filepath.Join(input, "dir")))
+	plan, err = PlanClean(input, destination, PlanOptions{})
+	req.NoError(err)
+	plan.Trash = trashPath
+	req.NoError(plan.Apply(nil))
+	req.NotNil(plan.Trashed())
+
+	_, err = os.Lstat(filepath.Join(destination, "file"))
+	req.True(os.IsNotExist(err))
+	entries, err := trash.Entries()
+	req.NoError(err)
+	req.Len(entries, 1)
+	id := entries[0].ID
+	req.Equal(destination, entries[0].Destination)
+	req.Equal([]string{"dir" + string(filepath.Separator), filepath.Join("dir", "nested"), "file"}, entries[0].Paths)
+	content, err := ioutil.ReadFile(filepath.Join(trashPath, id, "files", "dir", "nested"))
+	req.NoError(err)
+	req.Equal("c", string(content))
+
+	// restoring never overwrites, the other paths are restored anyway
+	testutil.WriteFiles(t, destination, map[string]string{"file": "new"})
+	restored, err := trash.Restore(id, nil)
+	req.EqualError(err, "Cannot restore 'file', already existing in the drive folder, left in the trash")
+	req.Equal([]string{"dir" + string(filepath.Separator), filepath.Join("dir", "nested")}, restored)
+	content, err = ioutil.ReadFile(filepath.Join(destination, "file"))
+	req.NoError(err)
+	req.Equal("new", string(content))
+	req.NoError(os.Remove(filepath.Join(destination, "file")))
+	entries, err = trash.Entries()
+	req.NoError(err)
+	req.Equal([]string{"file"}, entries[0].Paths)
+
+	content, err = ioutil.ReadFile(filepath.Join(destination, "dir", "nested"))
+	req.NoError(err)
+	req.Equal("c", string(content))
+	manifest, err := LoadManifest(destination)
+	req.NoError(err)
+	req.True(manifest.Owns("dir" + string(filepath.Separator)))
+	req.True(manifest.Owns(filepath.Join("dir", "nested")))
+	req.False(manifest.Owns("file"))
+
+	// fresh entries are kept by an expiring purge
+	purged, err := trash.Purge(nil, time.Hour)
+	req.NoError(err)
+	req.Empty(purged)
+	purged, err = trash.Purge([]string{id}, 0)
+	req.NoError(err)
+	req.Len(purged, 1)
+	entries, err = trash.Entries()
+	req.NoError(err)
+	req.Empty(entries)
+	_, err = trash.Restore(id, nil)
+	req.Error(err)
+
+	// malformed entries are skipped
+	req.NoError(os.MkdirAll(filepath.Join(trashPath, "malformed", "files"), os.ModePerm))
+	entries, err = trash.Entries()
+	req.NoError(err)
+	req.Empty(entries)
+	req.Len(warnings, 1)
+	purged, err = trash.Purge(nil, 0)
+	req.NoError(err)
+	req.Empty(purged)
+
+	// replaced files are moved to the trash as well
+	req.NoError(os.Remove(filepath.Join(input, "kept")))
+	testutil.WriteFiles(t, input, map[string]string{"kept": "changed"})
+	plan, err = PlanUpload(input, destination, driveignore, PlanOptions{Force: true})
+	req.NoError(err)
+	req.Len(plan.Operations, 1)
+	req.Equal(OpReplace, plan.Operations[0].Kind)
+	plan.Trash = trashPath
+	req.NoError(plan.Apply(nil))
+	req.NotNil(plan.Trashed())
+	req.Equal([]string{"kept"}, plan.Trashed().Paths)
+	content, err = ioutil.ReadFile(filepath.Join(trashPath, plan.Trashed().ID, "files", "kept"))
+	req.NoError(err)
+	req.Equal("a", string(content))
+	content, err = ioutil.ReadFile(filepath.Join(destination, "kept"))
+	req.NoError(err)
+	req.Equal("changed", string(content))
+}